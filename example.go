@@ -71,7 +71,7 @@ func main() {
 	}
 
 	// Register logging plugin
-	//api.RegisterPlugin(plugins.NewLogPlugin())
+	//api.RegisterPlugin(plugins.NewLogPlugin(o.GetLogger()))
 
 	// Register static middleware
 	//api.Middleware(web.StaticMiddleware("./static", web.StaticOption{IndexFile: "index.html"}))
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/gocraft/web"
+
+	"github.com/ryankurte/go-api/lib/formats"
+)
+
+// Admin endpoint paths
+const (
+	AdminRoutesPath    = "/routes"
+	AdminLivenessPath  = "/healthz"
+	AdminReadinessPath = "/readyz"
+	AdminPprofPath     = "/debug/pprof/"
+)
+
+// AdminHandle registers an operational handler (health, metrics, debug) for the provided pattern.
+// These are served on the internal admin listener where configured, or the public listener where --admin.public is set.
+func (api *API) AdminHandle(pattern string, h http.Handler) {
+	api.admin.Handle(pattern, h)
+}
+
+// registerAdmin attaches built in admin endpoints
+func (api *API) registerAdmin() {
+	api.AdminHandle(AdminRoutesPath, http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		writeFormatted(rw, req, http.StatusOK, api.Routes())
+	}))
+	api.AdminHandle(AdminLivenessPath, api.health.LivenessHandler())
+	api.AdminHandle(AdminReadinessPath, api.health.ReadinessHandler())
+	// Metrics are only exposed publicly where explicitly enabled
+	if api.metrics != nil && api.options.Metrics.Path != "" && (api.options.Admin.Address != "" || api.options.Metrics.Public) {
+		api.AdminHandle(api.options.Metrics.Path, api.metrics.Handler())
+	}
+
+	if !api.options.Admin.Pprof {
+		return
+	}
+	if api.options.Admin.Address == "" {
+		api.logger.Warn("PPROF REQUIRES AN ADMIN LISTENER ADDRESS, DEBUG ENDPOINTS DISABLED.")
+		return
+	}
+
+	api.AdminHandle(AdminPprofPath, http.HandlerFunc(pprof.Index))
+	api.AdminHandle(AdminPprofPath+"cmdline", http.HandlerFunc(pprof.Cmdline))
+	api.AdminHandle(AdminPprofPath+"profile", http.HandlerFunc(pprof.Profile))
+	api.AdminHandle(AdminPprofPath+"symbol", http.HandlerFunc(pprof.Symbol))
+	api.AdminHandle(AdminPprofPath+"trace", http.HandlerFunc(pprof.Trace))
+}
+
+// adminNotFound serves admin endpoints for requests not matching API routes,
+// for use where admin endpoints are explicitly exposed on the public listener
+func adminNotFound(admin *http.ServeMux) func(web.ResponseWriter, *web.Request) {
+	return func(rw web.ResponseWriter, req *web.Request) {
+		h, _ := admin.Handler(req.Request)
+		h.ServeHTTP(rw, req.Request)
+	}
+}
+
+// writeFormatted encodes an object using the formats package based on the request accept header
+func writeFormatted(rw http.ResponseWriter, req *http.Request, status int, o interface{}) {
+	out, contentType, err := formats.Encode(req.Header.Get("accept"), o)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusNotAcceptable)
+		return
+	}
+
+	rw.Header().Set("content-type", contentType)
+	rw.WriteHeader(status)
+	rw.Write([]byte(out))
+}
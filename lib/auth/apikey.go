@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"net/http"
+)
+
+// KeyValidator validates an API key, returning the associated principal
+type KeyValidator func(key string) (*Principal, error)
+
+// APIKey authenticates requests using API keys provided in a header or query parameter
+type APIKey struct {
+	header   string
+	query    string
+	validate KeyValidator
+}
+
+// NewAPIKey creates an API key authenticator, reading keys from the named header and/or query parameter
+// (either may be empty to disable), and validating keys with the provided validator.
+func NewAPIKey(header, query string, validate KeyValidator) *APIKey {
+	return &APIKey{header: header, query: query, validate: validate}
+}
+
+// StaticKeys builds a validator for a fixed map of API keys to principal IDs, comparing keys in constant time
+func StaticKeys(keys map[string]string) KeyValidator {
+	return func(key string) (*Principal, error) {
+		var id string
+		for k, v := range keys {
+			if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+				id = v
+			}
+		}
+		if id == "" {
+			return nil, ErrInvalidCredentials
+		}
+		return &Principal{ID: id}, nil
+	}
+}
+
+// Authenticate authenticates a request using the provided API key
+func (a *APIKey) Authenticate(req *http.Request) (*Principal, error) {
+	key := ""
+	if a.header != "" {
+		key = req.Header.Get(a.header)
+	}
+	if key == "" && a.query != "" {
+		key = req.URL.Query().Get(a.query)
+	}
+	if key == "" {
+		return nil, nil
+	}
+
+	p, err := a.validate(key)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, ErrInvalidCredentials
+	}
+	return p, nil
+}
+
+// Challenge builds an APIKey challenge naming the expected header or query parameter
+func (a *APIKey) Challenge(err error) string {
+	if a.header != "" {
+		return "APIKey header=" + quote(a.header)
+	}
+	return "APIKey query=" + quote(a.query)
+}
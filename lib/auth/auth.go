@@ -0,0 +1,212 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/ryankurte/go-api/lib/logging"
+	"github.com/ryankurte/go-api/lib/wrappers"
+)
+
+// Authentication errors
+var (
+	ErrAuthenticationRequired = errors.New("Authentication required")
+	ErrInvalidCredentials     = errors.New("Invalid credentials")
+)
+
+// Principal is an authenticated identity
+type Principal struct {
+	// Identifier for the principal (ie. user ID or JWT subject)
+	ID string
+	// Name of the authentication scheme used
+	Scheme string
+	// Roles or scopes granted to the principal
+	Roles []string
+	// Additional claims or attributes (ie. JWT claims)
+	Claims map[string]interface{}
+}
+
+// HasRole checks whether the principal has been granted the provided role or scope
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator authenticates requests using a single scheme
+type Authenticator interface {
+	// Authenticate fetches the principal for a request, returning nil where no credentials were provided,
+	// or an error where credentials were provided but are invalid
+	Authenticate(req *http.Request) (*Principal, error)
+	// Challenge builds the WWW-Authenticate challenge for the scheme (or empty for none),
+	// including details of any authentication error where applicable
+	Challenge(err error) string
+}
+
+type principalKey struct{}
+
+// WithPrincipal attaches an authenticated principal to the provided context
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// GetPrincipal fetches the authenticated principal for a request (or nil if not authenticated)
+func GetPrincipal(req *http.Request) *Principal {
+	p, _ := req.Context().Value(principalKey{}).(*Principal)
+	return p
+}
+
+// Authenticators is a registry of named authenticators, building guards to authenticate endpoints
+type Authenticators struct {
+	mu             sync.RWMutex
+	names          []string
+	authenticators map[string]Authenticator
+	required       []string
+}
+
+// New creates an empty authenticator registry
+func New() *Authenticators {
+	return &Authenticators{names: make([]string, 0), authenticators: make(map[string]Authenticator)}
+}
+
+// Add registers a named authenticator (ie. "jwt" or "apikey")
+func (a *Authenticators) Add(name string, auth Authenticator) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.authenticators[name]; !ok {
+		a.names = append(a.names, name)
+	}
+	a.authenticators[name] = auth
+}
+
+// cookieAuthenticator is implemented by authenticators using cookies (see Session)
+type cookieAuthenticator interface {
+	CookieName() string
+}
+
+// CookieNames fetches the names of cookies used by registered authenticators (see Session),
+// for which unsafe requests must be protected against CSRF (see security.CSRF)
+func (a *Authenticators) CookieNames() []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	names := make([]string, 0)
+	for _, n := range a.names {
+		if c, ok := a.authenticators[n].(cookieAuthenticator); ok {
+			names = append(names, c.CookieName())
+		}
+	}
+	return names
+}
+
+// Require builds a guard (see wrappers.Guard) requiring requests to be authenticated by any of the named
+// authenticators (or any registered authenticator where none are named), for use as a RegisterEndpoint argument.
+// Unauthenticated requests are rejected with a 401 response including WWW-Authenticate challenges.
+func (a *Authenticators) Require(names ...string) wrappers.Guard {
+	return a.guard(true, names)
+}
+
+// Optional builds a guard authenticating requests where credentials are provided,
+// rejecting only requests with invalid credentials.
+func (a *Authenticators) Optional(names ...string) wrappers.Guard {
+	return a.guard(false, names)
+}
+
+// resolve fetches the named authenticators, or all authenticators where none are named
+func (a *Authenticators) resolve(names []string) ([]string, []Authenticator, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if len(names) == 0 {
+		names = a.names
+	}
+	authenticators := make([]Authenticator, len(names))
+	for i, n := range names {
+		auth, ok := a.authenticators[n]
+		if !ok {
+			return nil, nil, fmt.Errorf("Unknown authenticator '%s'", n)
+		}
+		authenticators[i] = auth
+	}
+	return names, authenticators, nil
+}
+
+// Validate checks that all authenticators named by guards (see Require and Optional) have been registered,
+// so typos are detected on startup rather than failing requests
+func (a *Authenticators) Validate() error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	for _, n := range a.required {
+		if _, ok := a.authenticators[n]; !ok {
+			return fmt.Errorf("Unknown authenticator '%s'", n)
+		}
+	}
+	return nil
+}
+
+func (a *Authenticators) guard(required bool, names []string) wrappers.Guard {
+	a.mu.Lock()
+	a.required = append(a.required, names...)
+	a.mu.Unlock()
+
+	return func(rw http.ResponseWriter, req *http.Request) (*http.Request, int, error) {
+		logger := logging.Logger(req.Context()).WithField("module", "auth")
+
+		// Authenticators are resolved per-request so they may be registered after endpoints (see Validate)
+		names, authenticators, err := a.resolve(names)
+		if err != nil {
+			logger.Errorf("Error resolving authenticators (%s)", err)
+			return req, http.StatusInternalServerError, errors.New("Internal Server Error")
+		}
+
+		for i, auth := range authenticators {
+			p, err := auth.Authenticate(req)
+			if err != nil {
+				// Reject invalid credentials, rather than falling back to other schemes
+				logger.WithField("scheme", names[i]).Debugf("Authentication failed (%s)", err)
+				if c := auth.Challenge(err); c != "" {
+					rw.Header().Add("WWW-Authenticate", c)
+				}
+				return req, http.StatusUnauthorized, ErrInvalidCredentials
+			}
+			if p != nil {
+				p.Scheme = names[i]
+				return req.WithContext(WithPrincipal(req.Context(), p)), 0, nil
+			}
+		}
+
+		if !required {
+			return req, 0, nil
+		}
+
+		for _, auth := range authenticators {
+			if c := auth.Challenge(nil); c != "" {
+				rw.Header().Add("WWW-Authenticate", c)
+			}
+		}
+		return req, http.StatusUnauthorized, ErrAuthenticationRequired
+	}
+}
+
+// authorization fetches the credentials for an Authorization header with the provided scheme
+func authorization(req *http.Request, scheme string) (string, bool) {
+	h := req.Header.Get("Authorization")
+	if len(h) <= len(scheme) || !strings.EqualFold(h[:len(scheme)], scheme) || h[len(scheme)] != ' ' {
+		return "", false
+	}
+	return strings.TrimSpace(h[len(scheme)+1:]), true
+}
+
+// quote quotes an auth-param value
+func quote(s string) string {
+	return `"` + strings.Replace(strings.Replace(s, `\`, `\\`, -1), `"`, `\"`, -1) + `"`
+}
@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ryankurte/go-api/lib/options"
+	"github.com/ryankurte/go-api/lib/security"
+	"github.com/ryankurte/go-api/lib/session"
+)
+
+var jwtSecret = []byte("auth-test-secret")
+
+func signJWT(t *testing.T, claims jwt.MapClaims) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtSecret)
+	require.Nil(t, err)
+	return token
+}
+
+func TestAuthenticators(t *testing.T) {
+	store := session.NewStore(session.NewMemory(), time.Hour, time.Hour, []byte("auth-session-secret"))
+	sessionAuth := NewSession(store, "auth")
+
+	a := New()
+	a.Add("jwt", NewJWT("api", []string{"HS256"}, StaticKey(jwtSecret)))
+	a.Add("apikey", NewAPIKey("X-API-Key", "api_key", StaticKeys(map[string]string{"test-key": "key-user"})))
+	a.Add("basic", NewBasic("api", func(username, password string) (*Principal, error) {
+		if username == "user" && password == "pass" {
+			return &Principal{ID: username}, nil
+		}
+		return nil, nil
+	}))
+	a.Add("session", sessionAuth)
+
+	run := func(g func(rw http.ResponseWriter, req *http.Request) (*http.Request, int, error), req *http.Request) (*Principal, *httptest.ResponseRecorder, int, error) {
+		rw := httptest.NewRecorder()
+		r, status, err := g(rw, req)
+		return GetPrincipal(r), rw, status, err
+	}
+
+	t.Run("Authenticates bearer JWTs", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+signJWT(t, jwt.MapClaims{
+			"sub": "jwt-user", "scope": "read write", "exp": time.Now().Add(time.Hour).Unix(),
+		}))
+
+		p, _, _, err := run(a.Require("jwt"), req)
+		require.Nil(t, err)
+		require.NotNil(t, p)
+		assert.Equal(t, "jwt-user", p.ID)
+		assert.Equal(t, "jwt", p.Scheme)
+		assert.True(t, p.HasRole("write"))
+	})
+
+	t.Run("Rejects invalid JWTs", func(t *testing.T) {
+		for _, token := range []string{
+			"invalid",
+			signJWT(t, jwt.MapClaims{"sub": "jwt-user", "exp": time.Now().Add(-time.Hour).Unix()}),
+			signJWT(t, jwt.MapClaims{"sub": "jwt-user"}),
+		} {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+
+			_, rw, status, err := run(a.Require("jwt"), req)
+			assert.Equal(t, ErrInvalidCredentials, err)
+			assert.Equal(t, http.StatusUnauthorized, status)
+			assert.Equal(t, `Bearer realm="api", error="invalid_token"`, rw.Header().Get("WWW-Authenticate"))
+		}
+	})
+
+	t.Run("Authenticates API keys", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/?api_key=test-key", nil)
+		p, _, _, err := run(a.Require("apikey"), req)
+		require.Nil(t, err)
+		assert.Equal(t, "key-user", p.ID)
+
+		req = httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-API-Key", "wrong-key")
+		_, _, status, _ := run(a.Require("apikey"), req)
+		assert.Equal(t, http.StatusUnauthorized, status)
+	})
+
+	t.Run("Authenticates basic credentials", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.SetBasicAuth("user", "pass")
+		p, _, _, err := run(a.Require("basic"), req)
+		require.Nil(t, err)
+		assert.Equal(t, "user", p.ID)
+
+		req.SetBasicAuth("user", "wrong")
+		_, rw, status, _ := run(a.Require("basic"), req)
+		assert.Equal(t, http.StatusUnauthorized, status)
+		assert.Equal(t, `Basic realm="api", charset="UTF-8"`, rw.Header().Get("WWW-Authenticate"))
+	})
+
+	t.Run("Authenticates sessions", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		require.Nil(t, sessionAuth.Login(rw, httptest.NewRequest(http.MethodPost, "/login", nil), "session-user"))
+		cookies := rw.Result().Cookies()
+		require.Len(t, cookies, 1)
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(cookies[0])
+		p, _, _, err := run(a.Require(), req)
+		require.Nil(t, err)
+		assert.Equal(t, "session-user", p.ID)
+		assert.Equal(t, "session", p.Scheme)
+
+		// Sessions do not authenticate requests to CSRF exempt routes
+		o := options.Base{}
+		o.CSRF.Exempt = true
+		req = httptest.NewRequest(http.MethodPost, "/", nil)
+		req.AddCookie(cookies[0])
+		security.CSRF(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) { req = r }), &o, store).ServeHTTP(httptest.NewRecorder(), req)
+		_, _, status, _ := run(a.Require(), req)
+		assert.Equal(t, http.StatusUnauthorized, status)
+
+		req = httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(cookies[0])
+		require.Nil(t, sessionAuth.Logout(httptest.NewRecorder(), req))
+
+		req = httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(cookies[0])
+		_, _, status, _ = run(a.Require("session"), req)
+		assert.Equal(t, http.StatusUnauthorized, status)
+	})
+
+	t.Run("Challenges unauthenticated requests", func(t *testing.T) {
+		_, rw, status, err := run(a.Require("jwt", "apikey", "basic", "session"), httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, ErrAuthenticationRequired, err)
+		assert.Equal(t, http.StatusUnauthorized, status)
+		assert.Equal(t, []string{`Bearer realm="api"`, `APIKey header="X-API-Key"`, `Basic realm="api", charset="UTF-8"`}, rw.Header()["Www-Authenticate"])
+	})
+
+	t.Run("Allows unauthenticated requests where optional", func(t *testing.T) {
+		p, _, _, err := run(a.Optional(), httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Nil(t, err)
+		assert.Nil(t, p)
+	})
+
+	t.Run("Rejects unknown authenticators", func(t *testing.T) {
+		require.Nil(t, a.Validate())
+
+		g := a.Require("unknown")
+		assert.EqualError(t, a.Validate(), "Unknown authenticator 'unknown'")
+
+		_, _, status, err := run(g, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.NotNil(t, err)
+		assert.Equal(t, http.StatusInternalServerError, status)
+	})
+}
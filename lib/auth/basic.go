@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"net/http"
+)
+
+// PasswordValidator validates a username and password, returning the associated principal
+type PasswordValidator func(username, password string) (*Principal, error)
+
+// Basic authenticates requests using HTTP Basic authentication (RFC 7617).
+// This should only be used over TLS.
+type Basic struct {
+	realm    string
+	validate PasswordValidator
+}
+
+// NewBasic creates an HTTP Basic authenticator, validating credentials with the provided validator
+func NewBasic(realm string, validate PasswordValidator) *Basic {
+	return &Basic{realm: realm, validate: validate}
+}
+
+// Authenticate authenticates a request using Basic credentials in the Authorization header
+func (b *Basic) Authenticate(req *http.Request) (*Principal, error) {
+	if _, ok := authorization(req, "Basic"); !ok {
+		return nil, nil
+	}
+	username, password, ok := req.BasicAuth()
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+
+	p, err := b.validate(username, password)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, ErrInvalidCredentials
+	}
+	return p, nil
+}
+
+// Challenge builds a Basic challenge
+func (b *Basic) Challenge(err error) string {
+	return "Basic realm=" + quote(b.realm) + `, charset="UTF-8"`
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWT authenticates requests with bearer JSON Web Tokens (RFC 6750).
+// The principal ID is the token subject, with roles from "roles" or space separated "scope" claims.
+type JWT struct {
+	realm   string
+	keyFunc jwt.Keyfunc
+	parser  *jwt.Parser
+}
+
+// NewJWT creates a bearer JWT authenticator, accepting tokens signed with the provided methods (ie. "RS256")
+// using keys from the provided key function. Parser options may be provided to validate issuer, audience etc.
+func NewJWT(realm string, methods []string, keyFunc jwt.Keyfunc, opts ...jwt.ParserOption) *JWT {
+	opts = append(opts, jwt.WithValidMethods(methods), jwt.WithExpirationRequired())
+	return &JWT{realm: realm, keyFunc: keyFunc, parser: jwt.NewParser(opts...)}
+}
+
+// StaticKey builds a key function returning a single key (ie. an HMAC secret or public key)
+func StaticKey(key interface{}) jwt.Keyfunc {
+	return func(t *jwt.Token) (interface{}, error) {
+		return key, nil
+	}
+}
+
+// Authenticate authenticates a request using the bearer token in the Authorization header
+func (j *JWT) Authenticate(req *http.Request) (*Principal, error) {
+	token, ok := authorization(req, "Bearer")
+	if !ok {
+		return nil, nil
+	}
+
+	claims := jwt.MapClaims{}
+	if _, err := j.parser.ParseWithClaims(token, claims, j.keyFunc); err != nil {
+		return nil, err
+	}
+
+	sub, err := claims.GetSubject()
+	if err != nil || sub == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	p := Principal{ID: sub, Roles: make([]string, 0), Claims: claims}
+	if roles, ok := claims["roles"].([]interface{}); ok {
+		for _, r := range roles {
+			if s, ok := r.(string); ok {
+				p.Roles = append(p.Roles, s)
+			}
+		}
+	}
+	if scope, ok := claims["scope"].(string); ok {
+		p.Roles = append(p.Roles, strings.Fields(scope)...)
+	}
+
+	return &p, nil
+}
+
+// Challenge builds a Bearer challenge, indicating invalid tokens where applicable
+func (j *JWT) Challenge(err error) string {
+	c := "Bearer realm=" + quote(j.realm)
+	if err != nil {
+		c += `, error="invalid_token"`
+	}
+	return c
+}
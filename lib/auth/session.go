@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/gorilla/sessions"
+
+	"github.com/ryankurte/go-api/lib/security"
+	"github.com/ryankurte/go-api/lib/session"
+)
+
+// SessionPrincipalKey is the session value key for authenticated principal IDs
+const SessionPrincipalKey = "principal"
+
+// Session authenticates requests using the principal ID stored in a session cookie (see Login).
+// Session authenticated endpoints should be protected against CSRF (see security.CSRF),
+// so requests to CSRF exempt routes (see security.CSRFExempt) are not authenticated.
+type Session struct {
+	store sessions.Store
+	name  string
+}
+
+// NewSession creates a session authenticator using the named session in the provided store
+func NewSession(store sessions.Store, name string) *Session {
+	return &Session{store: store, name: name}
+}
+
+// Authenticate authenticates a request using the session principal
+func (s *Session) Authenticate(req *http.Request) (*Principal, error) {
+	if security.IsCSRFExempt(req) {
+		return nil, nil
+	}
+	if _, err := req.Cookie(s.name); err != nil {
+		return nil, nil
+	}
+
+	// Sessions that fail to load (ie. expired or following secret rotation) are treated as unauthenticated
+	sess, err := s.store.Get(req, s.name)
+	if err != nil {
+		return nil, nil
+	}
+	id, ok := sess.Values[SessionPrincipalKey].(string)
+	if !ok || id == "" {
+		return nil, nil
+	}
+
+	return &Principal{ID: id}, nil
+}
+
+// Challenge returns no challenge, as there is no WWW-Authenticate scheme for session cookies
+func (s *Session) Challenge(err error) string {
+	return ""
+}
+
+// Login stores the principal ID in the session, rotating the session ID where supported to prevent session fixation.
+// Any CSRF secret is also rotated (see security.RotateCSRFSecret), so tokens issued prior to login may not be used.
+func (s *Session) Login(rw http.ResponseWriter, req *http.Request, id string) error {
+	sess, _ := s.store.Get(req, s.name)
+	sess.Values[SessionPrincipalKey] = id
+
+	var err error
+	if r, ok := s.store.(session.Rotator); ok {
+		err = r.Rotate(req, rw, sess)
+	} else {
+		err = sess.Save(req, rw)
+	}
+	if err != nil {
+		return err
+	}
+	return security.RotateCSRFSecret(rw, req)
+}
+
+// CookieName fetches the name of the session cookie used to authenticate requests
+func (s *Session) CookieName() string {
+	return s.name
+}
+
+// Logout revokes the session
+func (s *Session) Logout(rw http.ResponseWriter, req *http.Request) error {
+	sess, _ := s.store.Get(req, s.name)
+	sess.Options.MaxAge = -1
+	return sess.Save(req, rw)
+}
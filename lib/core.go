@@ -1,18 +1,30 @@
 package api
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"net/http"
+	"os"
 	"path"
+	"reflect"
+	"time"
 
 	"github.com/gocraft/web"
 	"github.com/gorilla/sessions"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/ryankurte/go-api/lib/auth"
+	"github.com/ryankurte/go-api/lib/health"
+	"github.com/ryankurte/go-api/lib/logging"
+	"github.com/ryankurte/go-api/lib/metrics"
 	"github.com/ryankurte/go-api/lib/options"
 	"github.com/ryankurte/go-api/lib/router"
 	"github.com/ryankurte/go-api/lib/security"
 	"github.com/ryankurte/go-api/lib/servers"
+	"github.com/ryankurte/go-api/lib/session"
+	"github.com/ryankurte/go-api/lib/tracing"
+	"github.com/ryankurte/go-api/lib/wrappers"
 )
 
 // API is a core API server instance
@@ -21,90 +33,327 @@ type API struct {
 	options      *options.Base
 	logger       log.FieldLogger
 	server       servers.Handler
+	adminServer  servers.Handler
+	admin        *http.ServeMux
+	health       *health.Registry
+	metrics      *metrics.Metrics
+	tracing      *tracing.Tracing
+	reporters    []wrappers.PanicReporter
+	cspSinks     []security.CSPReportSink
 	sessionStore sessions.Store
+	sessions     []string
+	injectors    *wrappers.Injectors
+	auth         *auth.Authenticators
 }
 
 // New creates a new API server
 func New(ctx interface{}, o *options.Base) (*API, error) {
 	var err error
 	a := API{
-		options: o,
-		logger:  log.New().WithField("module", "core"),
+		options:   o,
+		logger:    o.GetLogger().WithField("module", "core"),
+		admin:     http.NewServeMux(),
+		health:    health.NewRegistry(),
+		auth:      auth.New(),
+		injectors: wrappers.NewInjectors(),
 	}
 
+	// HTTP/3 is only served alongside TLS
+	if o.Mode == options.ModeHTTP3 && o.NoTLS {
+		return nil, fmt.Errorf("HTTP/3 requires TLS (mode: %s), remove --tls.disable or use http or h2c mode", o.Mode)
+	}
+
+	// Log via the configured logger outside of request scoped middleware
+	logging.SetDefaultLogger(o.GetLogger())
+
+	// Report not ready unless the server is running (ie. while starting or draining)
+	a.health.AddReadiness(health.Check{Name: "server", Critical: true, Fn: a.serverReady})
+
 	// Create an API router
 	base := web.New(ctx)
-	a.Router = router.New(base, ctx, "")
+	a.Router = router.New(base, ctx, "", o.GetLogger().WithField("module", "router"))
+	args := []interface{}{wrappers.MaxBodySize(o.MaxBodySize), wrappers.PanicReporter(a.reportPanic), a.injectors}
+
+	// Attach endpoint metrics
+	if !o.NoMetrics {
+		a.metrics = metrics.New(o.Metrics.Namespace)
+		args = append(args, a.metrics)
+	}
+
+	// Attach request tracing
+	if !o.NoTracing {
+		a.tracing = tracing.New(o.Tracing.ServiceName, o.Tracing.SampleRatio)
+		if o.Tracing.Exporter == options.TraceExporterStdout {
+			e, err := tracing.NewStdoutExporter(os.Stdout)
+			if err != nil {
+				return nil, err
+			}
+			a.tracing.AddExporter(e)
+		}
+		args = append(args, a.tracing)
+	}
+
+	a.Router.SetDefaultArgs(args...)
 
 	// Attach session storage
+	if o.Session.Secret == "" && o.CookieSecret != "" {
+		a.logger.Warn("--cookie-secret is deprecated, use --cookie.secret")
+		a.options.Session.Secret = o.CookieSecret
+	}
 	if o.Session.Secret == "" {
+		// Random secrets are not shared between instances, so serverless modes require a configured secret
+		switch {
+		case o.Session.RequireSecret, o.Mode == options.ModeLambda, o.Mode == options.ModeCloudEvents, o.Mode == options.ModeFunction:
+			return nil, fmt.Errorf("No session secret configured (mode: %s), set --cookie.secret or SESSION_SECRET", o.Mode)
+		}
+		a.logger.Warn("NO SESSION SECRET CONFIGURED. USING A RANDOM SECRET, SESSIONS WILL NOT PERSIST ACROSS RESTARTS OR INSTANCES.")
+
 		a.options.Session.Secret, err = options.GenerateSecret(256)
 		if err != nil {
 			return nil, err
 		}
+		if o.Session.EncryptionKey == "" {
+			a.options.Session.EncryptionKey, err = options.GenerateSecret(32)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	keyPairs, err := o.Session.KeyPairs()
+	if err != nil {
+		return nil, fmt.Errorf("Error loading session secrets (%s)", err)
+	}
+
+	// Cookie sessions keep the default cookie max age unless a lifetime is set
+	lifetime := o.Session.MaxLifetime
+	if lifetime == 0 {
+		lifetime = options.DefaultSessionLifetime
+	}
+
+	var cookieOptions *sessions.Options
+	switch o.Session.Backend {
+	case options.SessionBackendMemory:
+		store := session.NewStore(session.NewMemory(), o.Session.MaxIdle, lifetime, keyPairs...)
+		a.sessionStore, cookieOptions = store, store.Options
+	case options.SessionBackendFilesystem:
+		backend, err := session.NewFilesystem(o.Session.Dir)
+		if err != nil {
+			return nil, err
+		}
+		store := session.NewStore(backend, o.Session.MaxIdle, lifetime, keyPairs...)
+		a.sessionStore, cookieOptions = store, store.Options
+	default:
+		store := sessions.NewCookieStore(keyPairs...)
+		if o.Session.MaxLifetime > 0 {
+			store.MaxAge(int(o.Session.MaxLifetime.Seconds()))
+		}
+		a.sessionStore, cookieOptions = store, store.Options
 	}
 
-	sessionStore := sessions.NewCookieStore([]byte(o.Session.Secret))
 	if a.options.Session.DisableSecure {
-		log.Warn("SECURE COOKIE FLAG IS DISABLED. DEVELOPMENT USE ONLY.")
-		sessionStore.Options.Secure = false
+		a.logger.Warn("SECURE COOKIE FLAG IS DISABLED. DEVELOPMENT USE ONLY.")
+		cookieOptions.Secure = false
 	} else {
-		sessionStore.Options.Secure = true
+		cookieOptions.Secure = true
 	}
-	sessionStore.Options.HttpOnly = true
+	cookieOptions.HttpOnly = true
 	if a.options.ExternalAddress != "" {
-		sessionStore.Options.Domain = o.ExternalAddress
+		cookieOptions.Domain = o.ExternalAddress
+	}
+
+	// Allow handlers to rotate and revoke sessions (using this instance's session store)
+	if err := a.injectors.Register(reflect.TypeOf(&session.Control{}), func(req *http.Request) (interface{}, error) {
+		return &session.Control{}, nil
+	}); err != nil {
+		return nil, err
+	}
+	if err := a.injectors.RegisterFinalizer(reflect.TypeOf(&session.Control{}), func(rw http.ResponseWriter, req *http.Request, v interface{}) error {
+		return v.(*session.Control).Apply(a.sessionStore, rw, req)
+	}); err != nil {
+		return nil, err
 	}
-	a.sessionStore = sessionStore
 
 	return &a, nil
 }
 
+// Auth fetches the API authenticator registry, used to register authenticators
+// and build authentication requirements for endpoints (ie. api.Auth().Require("jwt"))
+func (api *API) Auth() *auth.Authenticators {
+	return api.auth
+}
+
 // SessionStore fetches the API service session store
 func (api *API) SessionStore() sessions.Store {
 	return api.sessionStore
 }
 
+// SetSessionStore replaces the API service session store (ie. with a session.Store using a Redis or SQL backend).
+// This must be called prior to running the server.
+func (api *API) SetSessionStore(store sessions.Store) {
+	api.sessionStore = store
+}
+
 // Run launches an API server
 func (api *API) Run() error {
+	// Check authenticators named by endpoints have been registered
+	if err := api.auth.Validate(); err != nil {
+		return fmt.Errorf("Error validating authenticators (%s)", err)
+	}
+
 	base := api.GetBaseRouter()
 
 	// Enable static file hosting if configured
 	if api.options.StaticDir != "" {
 		staticPath := path.Clean(api.options.StaticDir)
 		base = base.Middleware(web.StaticMiddleware(staticPath))
-		log.Printf("Serving static content from: '%s'", staticPath)
+		api.logger.Infof("Serving static content from: '%s'", staticPath)
 	}
 
-	// Enable endpoint logging if specified
+	// Record matched routes for the access log
 	if api.options.LogEndpoints {
-		base = base.Middleware(web.LoggerMiddleware)
+		base = base.Middleware(logging.RecordRoute)
+	}
+
+	// Serve admin endpoints on the internal listener where configured,
+	// or where explicitly enabled, on the public listener for requests not matching API routes
+	api.registerAdmin()
+	switch {
+	case api.options.Admin.Address != "":
+		// Served by the admin server
+	case api.options.Admin.Public:
+		api.logger.Warn("ADMIN ENDPOINTS ARE EXPOSED ON THE PUBLIC LISTENER. USE --admin.address WHERE POSSIBLE.")
+		base.NotFound(adminNotFound(api.admin))
+	default:
+		api.logger.Info("No admin listener configured (--admin.address), health, metrics and route endpoints are disabled")
 	}
 
 	// Setup handlers
 	var h http.Handler = base
-	h = security.CORS(h, api.options)
-	h = security.CSP(h, api.options)
+
+	// Apply CORS, CSP and CSRF policies, with any router or endpoint overrides
+	// (sharing CSP inline asset hashes and report limits between policies),
+	// checking CSRF tokens for requests carrying registered session or session authenticator cookies
+	csp := security.NewCSPBuilder(api.options, api.cspReportSinks()...)
+	cookies := append(append([]string{}, api.sessions...), api.auth.CookieNames()...)
+	h = security.PolicyHandler(h, api.options, api.Policies(), func(h http.Handler, o *options.Base) http.Handler {
+		h = security.CSRF(h, o, api.sessionStore, cookies...)
+		h = security.CORS(h, o)
+		return csp.Build(h, o)
+	})
+	h = security.Headers(h, api.options)
+
+	// Extract traces at the edge of the handler chain
+	if api.tracing != nil {
+		h = api.tracing.Middleware(h)
+	}
+
+	// Recover panics outside of typed endpoints
+	h = wrappers.Recover(h, api.reportPanic)
+
+	// Enable structured access logging if specified, including responses written by any middleware
+	if api.options.LogEndpoints {
+		h = logging.AccessLog(h)
+	}
+
+	// Attach request IDs and request scoped loggers
+	h = logging.RequestID(h, api.options.GetLogger())
 
 	// Create server instance
 	var server servers.Handler
 	switch api.options.Mode {
 	case options.ModeHTTP:
 		server = servers.NewHTTP(api.options, h)
+	case options.ModeH2C:
+		server = servers.NewH2C(api.options, h)
+	case options.ModeHTTP3:
+		server = servers.NewHTTP3(api.options, h)
 	case options.ModeLambda:
 		server = servers.NewLambda(api.options, h)
+	case options.ModeCloudEvents:
+		server = servers.NewCloudEvents(api.options, h)
+	case options.ModeFunction:
+		server = servers.NewFunction(api.options, h)
 	default:
-		log.Errorf("Unhandled mode: '%s'", api.options.Mode)
+		api.logger.Errorf("Unhandled mode: '%s'", api.options.Mode)
 		return errors.New("unhandled server mode")
 	}
 	api.server = server
 
+	if api.options.Admin.Address != "" {
+		api.adminServer = servers.NewAdmin(api.options, api.admin)
+		go api.adminServer.Run()
+	}
+
 	api.server.Run()
 
 	return nil
 }
 
 // Close closes an API server (if bound)
+// The admin server is closed last so readiness reports failure while the API server drains.
 func (api *API) Close() {
 	api.server.Close()
+	if api.adminServer != nil {
+		api.adminServer.Close()
+	}
+	if api.tracing != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		api.tracing.Close(ctx)
+		cancel()
+	}
+}
+
+// Metrics fetches the API endpoint metrics (nil if disabled)
+func (api *API) Metrics() *metrics.Metrics {
+	return api.metrics
+}
+
+// Tracing fetches the API request tracing (nil if disabled)
+func (api *API) Tracing() *tracing.Tracing {
+	return api.tracing
+}
+
+// AddCSPReportSink registers a sink for CSP violation reports received at the CSP report address
+func (api *API) AddCSPReportSink(s security.CSPReportSink) {
+	api.cspSinks = append(api.cspSinks, s)
+}
+
+func (api *API) cspReportSinks() []security.CSPReportSink {
+	sinks := []security.CSPReportSink{security.NewCSPLogSink(api.options.GetLogger().WithField("module", "csp"))}
+	if api.metrics != nil {
+		sinks = append(sinks, api.metrics)
+	}
+	return append(sinks, api.cspSinks...)
+}
+
+// AddPanicReporter registers a reporter called when handlers panic (see wrappers.PanicReporter)
+func (api *API) AddPanicReporter(r wrappers.PanicReporter) {
+	api.reporters = append(api.reporters, r)
+}
+
+func (api *API) reportPanic(req *http.Request, recovered interface{}, stack []byte) {
+	for _, r := range api.reporters {
+		r(req, recovered, stack)
+	}
+}
+
+// AddLivenessCheck registers a health check reported by the liveness endpoint
+func (api *API) AddLivenessCheck(c health.Check) error {
+	return api.health.AddLiveness(c)
+}
+
+// AddReadinessCheck registers a health check reported by the readiness endpoint
+func (api *API) AddReadinessCheck(c health.Check) error {
+	return api.health.AddReadiness(c)
+}
+
+func (api *API) serverReady(ctx context.Context) error {
+	if api.server == nil {
+		return errors.New("Server not started")
+	}
+	if state := api.server.State(); state != servers.StateRunning {
+		return fmt.Errorf("Server %s", state)
+	}
+	return nil
 }
@@ -6,13 +6,20 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/ryankurte/go-api/lib/auth"
+	"github.com/ryankurte/go-api/lib/logging"
 	"github.com/ryankurte/go-api/lib/options"
+	"github.com/ryankurte/go-api/lib/servers"
 )
 
 // AppContext Application Context object
@@ -51,6 +58,11 @@ func (c *APIContext) FakeEndpoint(i Request, h http.Header) (Response, error) {
 	return o, nil
 }
 
+// PanicEndpoint AppContext Endpoint handler function that panics
+func (c *AppContext) PanicEndpoint(i Request) (Response, error) {
+	panic("test panic")
+}
+
 func (c *APIContext) ContextEndpoint(i Request) (APIContext, error) {
 	return *c, nil
 }
@@ -78,6 +90,7 @@ func TestCore(t *testing.T) {
 
 	go api.Run()
 	defer api.Close()
+	require.Nil(t, servers.WaitForListener("127.0.0.1:9002", time.Second))
 
 	client := http.DefaultClient
 
@@ -167,3 +180,235 @@ func TestCore(t *testing.T) {
 	})
 
 }
+
+func TestAdmin(t *testing.T) {
+	get := func(t *testing.T, url string) (int, string) {
+		resp, err := http.Get(url)
+		require.Nil(t, err)
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.Nil(t, err)
+		return resp.StatusCode, string(body)
+	}
+
+	t.Run("Serves admin endpoints on the admin listener", func(t *testing.T) {
+		o := options.Base{BindAddress: "127.0.0.1", Port: "9003", Mode: options.ModeHTTP}
+		o.NoTLS = true
+		o.Admin.Address = "127.0.0.1:9004"
+		o.Admin.Pprof = true
+		o.Metrics.Path = "/metrics"
+		o.Metrics.Namespace = "test"
+
+		api, err := New(AppContext{}, &o)
+		require.Nil(t, err)
+		require.Nil(t, api.RegisterEndpoint("/", "GET", (*AppContext).FakeEndpoint))
+
+		sr := api.Subrouter(APIContext{}, "/api")
+		require.Nil(t, sr.RegisterEndpoint("/test", "POST", (*APIContext).FakeEndpoint))
+
+		go api.Run()
+		defer api.Close()
+		require.Nil(t, servers.WaitForListener("127.0.0.1:9003", time.Second))
+		require.Nil(t, servers.WaitForListener("127.0.0.1:9004", time.Second))
+
+		code, body := get(t, "http://127.0.0.1:9004/routes")
+		assert.Equal(t, http.StatusOK, code)
+		assert.JSONEq(t, `[{"path":"/","method":"GET"},{"path":"/api/test","method":"POST"}]`, body)
+
+		code, _ = get(t, "http://127.0.0.1:9004/debug/pprof/")
+		assert.Equal(t, http.StatusOK, code)
+
+		code, _ = get(t, "http://127.0.0.1:9003/?message=test")
+		assert.Equal(t, http.StatusOK, code)
+		code, body = get(t, "http://127.0.0.1:9004/metrics")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Contains(t, body, `test_requests_total{method="GET",route="/",status="200"} 1`)
+
+		code, _ = get(t, "http://127.0.0.1:9003/routes")
+		assert.Equal(t, http.StatusNotFound, code)
+		code, _ = get(t, "http://127.0.0.1:9003/debug/pprof/")
+		assert.Equal(t, http.StatusNotFound, code)
+
+		code, _ = get(t, "http://127.0.0.1:9004/healthz")
+		assert.Equal(t, http.StatusOK, code)
+		code, _ = get(t, "http://127.0.0.1:9004/readyz")
+		assert.Equal(t, http.StatusOK, code)
+
+		// Readiness fails once the API server is closed
+		api.server.Close()
+		code, body = get(t, "http://127.0.0.1:9004/readyz")
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Contains(t, body, "Server stopped")
+	})
+
+	t.Run("Serves admin endpoints on the public listener only where enabled", func(t *testing.T) {
+		o := options.Base{BindAddress: "127.0.0.1", Port: "9005", Mode: options.ModeHTTP}
+		o.NoTLS = true
+
+		api, err := New(AppContext{}, &o)
+		require.Nil(t, err)
+
+		go api.Run()
+		defer api.Close()
+		require.Nil(t, servers.WaitForListener("127.0.0.1:9005", time.Second))
+
+		code, _ := get(t, "http://127.0.0.1:9005/routes")
+		assert.Equal(t, http.StatusNotFound, code)
+		code, _ = get(t, "http://127.0.0.1:9005/healthz")
+		assert.Equal(t, http.StatusNotFound, code)
+	})
+
+	t.Run("Serves public admin endpoints without pprof or shadowing API routes", func(t *testing.T) {
+		o := options.Base{BindAddress: "127.0.0.1", Port: "9008", Mode: options.ModeHTTP}
+		o.NoTLS = true
+		o.Admin.Pprof = true
+		o.Admin.Public = true
+		o.Metrics.Path = "/metrics"
+
+		api, err := New(AppContext{}, &o)
+		require.Nil(t, err)
+		require.Nil(t, api.RegisterEndpoint("/healthz", "GET", (*AppContext).FakeEndpoint))
+
+		go api.Run()
+		defer api.Close()
+		require.Nil(t, servers.WaitForListener("127.0.0.1:9008", time.Second))
+
+		code, body := get(t, "http://127.0.0.1:9008/routes")
+		assert.Equal(t, http.StatusOK, code)
+		assert.JSONEq(t, `[{"path":"/healthz","method":"GET"}]`, body)
+		code, _ = get(t, "http://127.0.0.1:9008/debug/pprof/")
+		assert.Equal(t, http.StatusNotFound, code)
+		code, _ = get(t, "http://127.0.0.1:9008/metrics")
+		assert.Equal(t, http.StatusNotFound, code)
+
+		code, body = get(t, "http://127.0.0.1:9008/healthz?message=test")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Contains(t, body, "test")
+	})
+}
+
+func TestModes(t *testing.T) {
+	t.Run("HTTP/3 requires TLS", func(t *testing.T) {
+		o := options.Base{}
+		o.Mode = options.ModeHTTP3
+		o.NoTLS = true
+
+		_, err := New(AppContext{}, &o)
+		assert.NotNil(t, err)
+	})
+}
+
+func TestLogger(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+
+	o := options.Base{}
+	o.Logger = logger
+
+	api, err := New(AppContext{}, &o)
+	require.Nil(t, err)
+	require.Nil(t, api.RegisterEndpoint("/", "GET", (*AppContext).FakeEndpoint))
+
+	t.Run("Uses the provided logger across components", func(t *testing.T) {
+		modules := make(map[interface{}]bool)
+		for _, e := range hook.AllEntries() {
+			modules[e.Data["module"]] = true
+		}
+		assert.True(t, modules["router"])
+	})
+
+	t.Run("Uses the provided logger outside of request middleware", func(t *testing.T) {
+		assert.Equal(t, logger, logging.DefaultLogger())
+	})
+
+	t.Run("Creates loggers from level and format options", func(t *testing.T) {
+		o := options.Base{LogLevel: "debug", LogFormat: options.LogFormatJSON}
+		l, ok := o.GetLogger().(*log.Logger)
+		require.True(t, ok)
+		assert.Equal(t, log.DebugLevel, l.Level)
+		assert.IsType(t, &log.JSONFormatter{}, l.Formatter)
+		assert.Equal(t, o.GetLogger(), o.GetLogger())
+	})
+}
+
+func TestRecover(t *testing.T) {
+	o := options.Base{BindAddress: "127.0.0.1", Port: "9006", Mode: options.ModeHTTP}
+	o.NoTLS = true
+
+	api, err := New(AppContext{}, &o)
+	require.Nil(t, err)
+
+	reported := make(chan interface{}, 1)
+	api.AddPanicReporter(func(req *http.Request, recovered interface{}, stack []byte) {
+		reported <- recovered
+	})
+	require.Nil(t, api.RegisterEndpoint("/", "GET", (*AppContext).PanicEndpoint))
+
+	go api.Run()
+	defer api.Close()
+	require.Nil(t, servers.WaitForListener("127.0.0.1:9006", time.Second))
+
+	resp, err := http.Get("http://127.0.0.1:9006/?message=test")
+	require.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.Equal(t, "test panic", <-reported)
+
+	// Server continues handling requests
+	resp, err = http.Get("http://127.0.0.1:9006/?message=test")
+	require.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+}
+
+// Me AppContext Endpoint handler function returning the authenticated principal
+func (c *AppContext) Me(p *auth.Principal) (Response, error) {
+	if p == nil {
+		return Response{Message: "anonymous"}, nil
+	}
+	return Response{Message: p.ID}, nil
+}
+
+func TestAuth(t *testing.T) {
+	o := options.Base{}
+	o.NoTLS = true
+
+	api, err := New(AppContext{}, &o)
+	require.Nil(t, err)
+
+	api.Auth().Add("apikey", auth.NewAPIKey("X-API-Key", "", auth.StaticKeys(map[string]string{"test-key": "key-user"})))
+	require.Nil(t, api.RegisterEndpoint("/me", "GET", (*AppContext).Me, api.Auth().Require("apikey")))
+	require.Nil(t, api.RegisterEndpoint("/whoami", "GET", (*AppContext).Me, api.Auth().Optional()))
+
+	get := func(path, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		rw := httptest.NewRecorder()
+		api.GetBaseRouter().ServeHTTP(rw, req)
+		return rw
+	}
+
+	t.Run("Injects authenticated principals", func(t *testing.T) {
+		rw := get("/me", "test-key")
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.JSONEq(t, `{"Message":"key-user"}`, rw.Body.String())
+	})
+
+	t.Run("Rejects unauthenticated requests", func(t *testing.T) {
+		rw := get("/me", "")
+		assert.Equal(t, http.StatusUnauthorized, rw.Code)
+		assert.Equal(t, `APIKey header="X-API-Key"`, rw.Header().Get("WWW-Authenticate"))
+	})
+
+	t.Run("Allows optional authentication", func(t *testing.T) {
+		assert.JSONEq(t, `{"Message":"anonymous"}`, get("/whoami", "").Body.String())
+		assert.JSONEq(t, `{"Message":"key-user"}`, get("/whoami", "test-key").Body.String())
+		assert.Equal(t, http.StatusUnauthorized, get("/whoami", "wrong-key").Code)
+	})
+
+	t.Run("Rejects unknown authenticators on start", func(t *testing.T) {
+		require.Nil(t, api.RegisterEndpoint("/typo", "GET", (*AppContext).Me, api.Auth().Require("apikeyy")))
+		assert.NotNil(t, api.Run())
+	})
+}
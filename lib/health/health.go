@@ -0,0 +1,220 @@
+// Package health provides registrable health checks aggregated into liveness and readiness endpoints
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ryankurte/go-api/lib/formats"
+)
+
+// Health status constants
+const (
+	StatusOK       = "ok"
+	StatusDegraded = "degraded"
+	StatusFail     = "fail"
+)
+
+// DefaultTimeout is the check timeout used where none is specified
+var DefaultTimeout = 5 * time.Second
+
+// CheckFunc performs a health check, returning an error on failure
+type CheckFunc func(ctx context.Context) error
+
+// Check is a named health check
+type Check struct {
+	// Check name, must be unique within a registry
+	Name string
+	// Timeout after which the check fails (defaults to DefaultTimeout)
+	Timeout time.Duration
+	// Critical checks fail the overall status, non-critical checks degrade it
+	Critical bool
+	// Check function
+	Fn CheckFunc
+}
+
+// Result is the outcome of a single health check
+type Result struct {
+	Name     string `json:"name" yaml:"name" xml:"name"`
+	Status   string `json:"status" yaml:"status" xml:"status"`
+	Critical bool   `json:"critical" yaml:"critical" xml:"critical"`
+	Duration string `json:"duration" yaml:"duration" xml:"duration"`
+	Error    string `json:"error,omitempty" yaml:"error,omitempty" xml:"error,omitempty"`
+}
+
+// Report is the aggregated outcome of a set of health checks
+type Report struct {
+	Status string   `json:"status" yaml:"status" xml:"status"`
+	Checks []Result `json:"checks" yaml:"checks" xml:"check"`
+}
+
+// Registry collects liveness and readiness checks
+type Registry struct {
+	mu        sync.RWMutex
+	liveness  []Check
+	readiness []Check
+}
+
+// NewRegistry creates an empty health check registry
+func NewRegistry() *Registry {
+	return &Registry{
+		liveness:  make([]Check, 0),
+		readiness: make([]Check, 0),
+	}
+}
+
+// AddLiveness registers a check reporting whether the service is alive (and should not be restarted)
+func (r *Registry) AddLiveness(c Check) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := validate(r.liveness, c); err != nil {
+		return err
+	}
+	r.liveness = append(r.liveness, c)
+
+	return nil
+}
+
+// AddReadiness registers a check reporting whether the service is ready to accept requests
+func (r *Registry) AddReadiness(c Check) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := validate(r.readiness, c); err != nil {
+		return err
+	}
+	r.readiness = append(r.readiness, c)
+
+	return nil
+}
+
+func validate(checks []Check, c Check) error {
+	if c.Name == "" || c.Fn == nil {
+		return fmt.Errorf("Health checks require a name and check function")
+	}
+	for _, existing := range checks {
+		if existing.Name == c.Name {
+			return fmt.Errorf("Duplicate health check '%s'", c.Name)
+		}
+	}
+	return nil
+}
+
+// Liveness runs all liveness checks
+func (r *Registry) Liveness(ctx context.Context) Report {
+	r.mu.RLock()
+	checks := append([]Check{}, r.liveness...)
+	r.mu.RUnlock()
+
+	return Run(ctx, checks)
+}
+
+// Readiness runs all liveness and readiness checks, as a service that is not alive is not ready
+func (r *Registry) Readiness(ctx context.Context) Report {
+	r.mu.RLock()
+	checks := append(append([]Check{}, r.liveness...), r.readiness...)
+	r.mu.RUnlock()
+
+	return Run(ctx, checks)
+}
+
+// LivenessHandler creates an http.Handler serving liveness reports
+func (r *Registry) LivenessHandler() http.Handler {
+	return reportHandler(r.Liveness)
+}
+
+// ReadinessHandler creates an http.Handler serving readiness reports
+func (r *Registry) ReadinessHandler() http.Handler {
+	return reportHandler(r.Readiness)
+}
+
+// Run executes the provided checks concurrently and aggregates the results
+func Run(ctx context.Context, checks []Check) Report {
+	results := make([]Result, len(checks))
+
+	wg := sync.WaitGroup{}
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c Check) {
+			defer wg.Done()
+			results[i] = run(ctx, c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: results}
+	for _, r := range results {
+		if r.Status == StatusOK {
+			continue
+		}
+		if r.Critical {
+			report.Status = StatusFail
+		} else if report.Status == StatusOK {
+			report.Status = StatusDegraded
+		}
+	}
+
+	return report
+}
+
+func run(ctx context.Context, c Check) Result {
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	errs := make(chan error, 1)
+	go func() {
+		errs <- c.Fn(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-errs:
+	case <-ctx.Done():
+		err = fmt.Errorf("Timeout after %s", timeout)
+	}
+
+	r := Result{
+		Name:     c.Name,
+		Status:   StatusOK,
+		Critical: c.Critical,
+		Duration: time.Since(start).String(),
+	}
+	if err != nil {
+		r.Status = StatusFail
+		r.Error = err.Error()
+	}
+
+	return r
+}
+
+func reportHandler(fn func(ctx context.Context) Report) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		report := fn(req.Context())
+
+		status := http.StatusOK
+		if report.Status == StatusFail {
+			status = http.StatusServiceUnavailable
+		}
+
+		out, contentType, err := formats.Encode(req.Header.Get("accept"), report)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusNotAcceptable)
+			return
+		}
+
+		rw.Header().Set("content-type", contentType)
+		rw.Header().Set("cache-control", "no-store")
+		rw.WriteHeader(status)
+		rw.Write([]byte(out))
+	})
+}
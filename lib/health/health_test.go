@@ -0,0 +1,95 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func pass(ctx context.Context) error {
+	return nil
+}
+
+func fail(ctx context.Context) error {
+	return fmt.Errorf("failed")
+}
+
+func block(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+}
+
+func TestHealth(t *testing.T) {
+
+	t.Run("Rejects invalid and duplicate checks", func(t *testing.T) {
+		r := NewRegistry()
+		assert.NotNil(t, r.AddLiveness(Check{Name: "test"}))
+		assert.NotNil(t, r.AddLiveness(Check{Fn: pass}))
+		assert.Nil(t, r.AddLiveness(Check{Name: "test", Fn: pass}))
+		assert.NotNil(t, r.AddLiveness(Check{Name: "test", Fn: pass}))
+	})
+
+	t.Run("Aggregates check status", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			checks []Check
+			status string
+		}{
+			{"no checks", []Check{}, StatusOK},
+			{"passing checks", []Check{{Name: "a", Fn: pass, Critical: true}, {Name: "b", Fn: pass}}, StatusOK},
+			{"failing non-critical check", []Check{{Name: "a", Fn: pass, Critical: true}, {Name: "b", Fn: fail}}, StatusDegraded},
+			{"failing critical check", []Check{{Name: "a", Fn: fail, Critical: true}, {Name: "b", Fn: fail}}, StatusFail},
+		}
+
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				report := Run(context.Background(), test.checks)
+				assert.Equal(t, test.status, report.Status)
+				assert.Len(t, report.Checks, len(test.checks))
+			})
+		}
+	})
+
+	t.Run("Fails checks exceeding timeout", func(t *testing.T) {
+		report := Run(context.Background(), []Check{{Name: "slow", Fn: block, Timeout: 10 * time.Millisecond, Critical: true}})
+		assert.Equal(t, StatusFail, report.Status)
+		assert.Contains(t, report.Checks[0].Error, "Timeout")
+	})
+
+	t.Run("Readiness includes liveness checks", func(t *testing.T) {
+		r := NewRegistry()
+		require.Nil(t, r.AddLiveness(Check{Name: "live", Fn: pass}))
+		require.Nil(t, r.AddReadiness(Check{Name: "ready", Fn: fail, Critical: true}))
+
+		assert.Equal(t, StatusOK, r.Liveness(context.Background()).Status)
+		report := r.Readiness(context.Background())
+		assert.Equal(t, StatusFail, report.Status)
+		assert.Len(t, report.Checks, 2)
+	})
+
+	t.Run("Serves reports with status codes", func(t *testing.T) {
+		r := NewRegistry()
+		require.Nil(t, r.AddLiveness(Check{Name: "live", Fn: pass}))
+		require.Nil(t, r.AddReadiness(Check{Name: "ready", Fn: fail, Critical: true}))
+
+		rw := httptest.NewRecorder()
+		r.LivenessHandler().ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		assert.Equal(t, http.StatusOK, rw.Code)
+
+		rw = httptest.NewRecorder()
+		r.ReadinessHandler().ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		assert.Equal(t, http.StatusServiceUnavailable, rw.Code)
+
+		report := Report{}
+		require.Nil(t, json.Unmarshal(rw.Body.Bytes(), &report))
+		assert.Equal(t, StatusFail, report.Status)
+		assert.Equal(t, "failed", report.Checks[1].Error)
+	})
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/ryankurte/go-api/lib/auth"
+	"github.com/ryankurte/go-api/lib/logging"
+	"github.com/ryankurte/go-api/lib/security"
+	"github.com/ryankurte/go-api/lib/tracing"
+	"github.com/ryankurte/go-api/lib/wrappers"
+)
+
+// Register injectors for typed handler parameters provided by API components
+func init() {
+	// Verified mutual TLS peer identity (nil where no client certificate was verified)
+	wrappers.RegisterInjector(reflect.TypeOf(&security.PeerIdentity{}), func(req *http.Request) (interface{}, error) {
+		return security.GetPeerIdentity(req), nil
+	})
+
+	// Per-request CSP nonce for inline scripts and styles (empty where nonces are not enabled)
+	wrappers.RegisterInjector(reflect.TypeOf(security.CSPNonce("")), func(req *http.Request) (interface{}, error) {
+		return security.GetCSPNonce(req), nil
+	})
+
+	// Per-request CSRF token (empty where CSRF protection is not enabled)
+	wrappers.RegisterInjector(reflect.TypeOf(security.CSRFToken("")), func(req *http.Request) (interface{}, error) {
+		return security.GetCSRFToken(req)
+	})
+
+	// Authenticated principal (nil where the request was not authenticated, see auth.Authenticators)
+	wrappers.RegisterInjector(reflect.TypeOf(&auth.Principal{}), func(req *http.Request) (interface{}, error) {
+		return auth.GetPrincipal(req), nil
+	})
+
+	// Request context, carrying any trace started at the edge of the handler chain
+	wrappers.RegisterInjector(reflect.TypeOf((*context.Context)(nil)).Elem(), func(req *http.Request) (interface{}, error) {
+		return req.Context(), nil
+	})
+
+	// Request scoped logger, with request ID and trace fields where available
+	wrappers.RegisterInjector(reflect.TypeOf((*log.FieldLogger)(nil)).Elem(), func(req *http.Request) (interface{}, error) {
+		return logging.Logger(req.Context()).WithFields(tracing.LogFields(req.Context())), nil
+	})
+}
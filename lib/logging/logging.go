@@ -0,0 +1,164 @@
+// Package logging provides request IDs, request scoped loggers and structured access logging
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"regexp"
+	"sync/atomic"
+	"time"
+
+	"github.com/gocraft/web"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/ryankurte/go-api/lib/response"
+)
+
+// RequestIDHeader is the header used to propagate request IDs
+const RequestIDHeader = "X-Request-ID"
+
+// RequestIDField is the log field used for request IDs
+const RequestIDField = "request_id"
+
+// Incoming request IDs not matching this are replaced
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9\-_.:]{1,128}$`)
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	loggerKey
+	accessKey
+)
+
+// NewRequestID generates a random request ID
+func NewRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// WithRequestID attaches a request ID to the provided context
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// GetRequestID fetches the request ID from the provided context (empty if not set)
+func GetRequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// WithLogger attaches a request scoped logger to the provided context
+func WithLogger(ctx context.Context, logger log.FieldLogger) context.Context {
+	return context.WithValue(ctx, loggerKey, logger)
+}
+
+// Logger used where no request scoped logger is set (see SetDefaultLogger)
+var defaultLogger atomic.Value
+
+// SetDefaultLogger sets the logger used where contexts carry no request scoped logger
+// (ie. outside of request middleware), rather than the standard logger
+func SetDefaultLogger(logger log.FieldLogger) {
+	defaultLogger.Store(&logger)
+}
+
+// DefaultLogger fetches the default logger, falling back to the standard logger where not set
+func DefaultLogger() log.FieldLogger {
+	if l, ok := defaultLogger.Load().(*log.FieldLogger); ok {
+		return *l
+	}
+	return log.StandardLogger()
+}
+
+// Logger fetches the request scoped logger from the provided context,
+// falling back to the default logger where not set
+func Logger(ctx context.Context) log.FieldLogger {
+	if l, ok := ctx.Value(loggerKey).(log.FieldLogger); ok {
+		return l
+	}
+
+	logger := DefaultLogger()
+	if id := GetRequestID(ctx); id != "" {
+		logger = logger.WithField(RequestIDField, id)
+	}
+	return logger
+}
+
+// RequestID middleware accepts valid request IDs from the X-Request-ID header or generates new IDs,
+// attaching the ID and a request scoped logger to the request context and echoing the ID in the response.
+func RequestID(h http.Handler, logger log.FieldLogger) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		id := req.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = NewRequestID()
+			req.Header.Set(RequestIDHeader, id)
+		}
+
+		ctx := WithRequestID(req.Context(), id)
+		ctx = WithLogger(ctx, logger.WithField(RequestIDField, id))
+
+		rw.Header().Set(RequestIDHeader, id)
+		h.ServeHTTP(rw, req.WithContext(ctx))
+	})
+}
+
+// accessEntry collects request details set further down the handler chain for access logging
+type accessEntry struct {
+	route string
+}
+
+// SetRoute records the route template matched by a request, used to identify requests in the access log
+func SetRoute(ctx context.Context, route string) {
+	if e, ok := ctx.Value(accessKey).(*accessEntry); ok {
+		e.route = route
+	}
+}
+
+// RecordRoute is a gocraft/web middleware recording the route template matched by each request for the access log.
+// As root router middleware runs before routing, the route is recorded once the request has been handled.
+func RecordRoute(rw web.ResponseWriter, req *web.Request, next web.NextMiddlewareFunc) {
+	next(rw, req)
+	SetRoute(req.Context(), req.RoutePath())
+}
+
+// AccessLog middleware writes a structured access log entry for each request via the request scoped logger
+// (see RequestID), identifying requests by route template (see RecordRoute) rather than raw path where matched.
+// This should be applied at the edge of the handler chain so responses written by any middleware are logged.
+func AccessLog(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		entry := accessEntry{}
+		sw := response.NewWriter(rw)
+
+		h.ServeHTTP(sw, req.WithContext(context.WithValue(req.Context(), accessKey, &entry)))
+
+		remote, _, err := net.SplitHostPort(req.RemoteAddr)
+		if err != nil {
+			remote = req.RemoteAddr
+		}
+
+		status := sw.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		fields := log.Fields{
+			"method":     req.Method,
+			"route":      entry.route,
+			"status":     status,
+			"latency":    time.Since(start).String(),
+			"bytes":      sw.Size(),
+			"remote_ip":  remote,
+			"user_agent": req.UserAgent(),
+		}
+		if entry.route == "" {
+			fields["path"] = req.URL.Path
+		}
+
+		Logger(req.Context()).WithFields(fields).Info("Request")
+	})
+}
@@ -0,0 +1,130 @@
+package logging
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gocraft/web"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type Context struct{}
+
+func TestRequestID(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+
+	h := RequestID(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		Logger(req.Context()).Info("test")
+		rw.Write([]byte(GetRequestID(req.Context())))
+	}), logger)
+
+	t.Run("Generates request IDs", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		id := rw.Header().Get(RequestIDHeader)
+		assert.Len(t, id, 32)
+		assert.Equal(t, id, rw.Body.String())
+	})
+
+	t.Run("Propagates valid request IDs", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(RequestIDHeader, "abc-123")
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, req)
+
+		assert.Equal(t, "abc-123", rw.Header().Get(RequestIDHeader))
+		assert.Equal(t, "abc-123", rw.Body.String())
+	})
+
+	t.Run("Replaces invalid request IDs", func(t *testing.T) {
+		for _, id := range []string{"invalid id", strings.Repeat("a", 129), "<script>"} {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(RequestIDHeader, id)
+			rw := httptest.NewRecorder()
+			h.ServeHTTP(rw, req)
+
+			assert.NotEqual(t, id, rw.Header().Get(RequestIDHeader))
+			assert.Len(t, rw.Header().Get(RequestIDHeader), 32)
+		}
+	})
+
+	t.Run("Provides request scoped loggers", func(t *testing.T) {
+		hook.Reset()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(RequestIDHeader, "abc-123")
+		h.ServeHTTP(httptest.NewRecorder(), req)
+
+		require.NotNil(t, hook.LastEntry())
+		assert.Equal(t, "abc-123", hook.LastEntry().Data[RequestIDField])
+	})
+
+	t.Run("Falls back to the default logger", func(t *testing.T) {
+		assert.Equal(t, log.StandardLogger(), Logger(context.Background()))
+		l := Logger(WithRequestID(context.Background(), "abc-123"))
+		assert.Equal(t, "abc-123", l.(*log.Entry).Data[RequestIDField])
+
+		SetDefaultLogger(logger)
+		defer SetDefaultLogger(log.StandardLogger())
+		assert.Equal(t, logger, Logger(context.Background()))
+	})
+}
+
+func TestAccessLog(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+
+	router := web.New(Context{})
+	router.Middleware(RecordRoute)
+	router.Get("/users/:id", func(ctx *Context, rw web.ResponseWriter, req *web.Request) {
+		rw.WriteHeader(http.StatusCreated)
+		rw.Write([]byte("test"))
+	})
+
+	// Middleware responding prior to the router
+	var h http.Handler = http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodOptions {
+			rw.WriteHeader(http.StatusNoContent)
+			return
+		}
+		router.ServeHTTP(rw, req)
+	})
+	h = RequestID(AccessLog(h), logger)
+
+	t.Run("Logs routed requests by route template", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/users/1234", nil)
+		req.Header.Set(RequestIDHeader, "abc-123")
+		req.Header.Set("User-Agent", "test-agent")
+		req.RemoteAddr = "10.0.0.1:1234"
+		h.ServeHTTP(httptest.NewRecorder(), req)
+
+		e := hook.LastEntry()
+		require.NotNil(t, e)
+		assert.Equal(t, "Request", e.Message)
+		assert.Equal(t, http.MethodGet, e.Data["method"])
+		assert.Equal(t, "/users/:id", e.Data["route"])
+		assert.NotContains(t, e.Data, "path")
+		assert.Equal(t, http.StatusCreated, e.Data["status"])
+		assert.Equal(t, 4, e.Data["bytes"])
+		assert.Equal(t, "10.0.0.1", e.Data["remote_ip"])
+		assert.Equal(t, "test-agent", e.Data["user_agent"])
+		assert.Equal(t, "abc-123", e.Data[RequestIDField])
+		assert.Contains(t, e.Data, "latency")
+	})
+
+	t.Run("Logs responses from middleware by path", func(t *testing.T) {
+		hook.Reset()
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodOptions, "/users/1234", nil))
+
+		e := hook.LastEntry()
+		require.NotNil(t, e)
+		assert.Equal(t, "", e.Data["route"])
+		assert.Equal(t, "/users/1234", e.Data["path"])
+		assert.Equal(t, http.StatusNoContent, e.Data["status"])
+	})
+}
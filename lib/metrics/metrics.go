@@ -0,0 +1,127 @@
+// Package metrics provides Prometheus metrics for typed API endpoints
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/ryankurte/go-api/lib/security"
+	"github.com/ryankurte/go-api/lib/wrappers"
+)
+
+// Metrics collects request metrics for typed endpoints, labelled by route template and method.
+// This implements wrappers.Instrument for binding to endpoints.
+type Metrics struct {
+	registry *prometheus.Registry
+	requests *prometheus.CounterVec
+	errors   *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	phases   *prometheus.HistogramVec
+	inFlight *prometheus.GaugeVec
+	csp      *prometheus.CounterVec
+}
+
+// New creates a metrics instance with a new registry, using the provided metric namespace
+func New(namespace string) *Metrics {
+	labels := []string{"route", "method"}
+
+	m := Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "requests_total",
+			Help:      "Total endpoint requests by status code",
+		}, append(labels, "status")),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "errors_total",
+			Help:      "Total endpoint errors by the pipeline phase in which they occurred",
+		}, append(labels, "class")),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "request_duration_seconds",
+			Help:      "Endpoint request latency",
+			Buckets:   prometheus.DefBuckets,
+		}, labels),
+		phases: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "phase_duration_seconds",
+			Help:      "Endpoint latency by pipeline phase (decode, validate, inject, handler, encode)",
+			Buckets:   prometheus.DefBuckets,
+		}, append(labels, "phase")),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "requests_in_flight",
+			Help:      "Endpoint requests currently being handled",
+		}, labels),
+		csp: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "csp_violations_total",
+			Help:      "Total Content Security Policy violation reports received",
+		}, []string{"directive", "disposition"}),
+	}
+
+	m.registry.MustRegister(m.requests, m.errors, m.duration, m.phases, m.inFlight, m.csp)
+	m.registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+
+	return &m
+}
+
+// Registry fetches the underlying registry for registration of application metrics
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.registry
+}
+
+// Handler creates an http.Handler serving metrics in Prometheus text format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// ReportCSP counts a CSP violation report, implementing security.CSPReportSink
+func (m *Metrics) ReportCSP(r security.CSPReport) {
+	m.csp.WithLabelValues(r.EffectiveDirective, r.Disposition).Inc()
+}
+
+// Start begins observation of a request to the provided endpoint
+func (m *Metrics) Start(e wrappers.Endpoint, req *http.Request) wrappers.Observer {
+	m.inFlight.WithLabelValues(e.Route, e.Method).Inc()
+
+	return &observer{
+		metrics:  m,
+		endpoint: e,
+		start:    time.Now(),
+	}
+}
+
+// observer records metrics for a single request
+type observer struct {
+	metrics  *Metrics
+	endpoint wrappers.Endpoint
+	start    time.Time
+	once     sync.Once
+}
+
+func (o *observer) Phase(name string) func(err error) {
+	start := time.Now()
+	return func(err error) {
+		o.metrics.phases.WithLabelValues(o.endpoint.Route, o.endpoint.Method, name).Observe(time.Since(start).Seconds())
+		if err != nil {
+			o.metrics.errors.WithLabelValues(o.endpoint.Route, o.endpoint.Method, name).Inc()
+		}
+	}
+}
+
+func (o *observer) Finish(status int) {
+	o.once.Do(func() {
+		e := o.endpoint
+		o.metrics.inFlight.WithLabelValues(e.Route, e.Method).Dec()
+		o.metrics.duration.WithLabelValues(e.Route, e.Method).Observe(time.Since(o.start).Seconds())
+		o.metrics.requests.WithLabelValues(e.Route, e.Method, strconv.Itoa(status)).Inc()
+	})
+}
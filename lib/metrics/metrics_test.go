@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ryankurte/go-api/lib/wrappers"
+)
+
+type Context struct{}
+
+type Message struct {
+	Message string `valid:"ascii,required"`
+}
+
+func scrape(t *testing.T, m *Metrics) string {
+	rw := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body, err := ioutil.ReadAll(rw.Body)
+	require.Nil(t, err)
+	return string(body)
+}
+
+func TestMetrics(t *testing.T) {
+	m := New("test")
+	e := wrappers.Endpoint{Route: "/users/:id", Method: http.MethodPost}
+
+	h, err := wrappers.BuildEndpoint(http.MethodPost, func(ctx Context, i Message) (Message, error) {
+		if i.Message == "fail" {
+			return i, fmt.Errorf("failed")
+		}
+		return i, nil
+	}, e, m)
+	require.Nil(t, err)
+
+	call := func(body string) {
+		req := httptest.NewRequest(http.MethodPost, "/users/1234", bytes.NewReader([]byte(body)))
+		h(Context{}, httptest.NewRecorder(), req)
+	}
+
+	call(`{"Message":"test"}`)
+	call(`{"Message":"fail"}`)
+	call(`{"Message":`)
+
+	out := scrape(t, m)
+
+	t.Run("Counts requests by route template and status", func(t *testing.T) {
+		assert.Contains(t, out, `test_requests_total{method="POST",route="/users/:id",status="200"} 1`)
+		assert.Contains(t, out, `test_requests_total{method="POST",route="/users/:id",status="500"} 1`)
+		assert.Contains(t, out, `test_requests_total{method="POST",route="/users/:id",status="400"} 1`)
+		assert.NotContains(t, out, "/users/1234")
+	})
+
+	t.Run("Counts errors by phase", func(t *testing.T) {
+		assert.Contains(t, out, `test_errors_total{class="handler",method="POST",route="/users/:id"} 1`)
+		assert.Contains(t, out, `test_errors_total{class="decode",method="POST",route="/users/:id"} 1`)
+	})
+
+	t.Run("Records phase latency", func(t *testing.T) {
+		for _, phase := range []string{wrappers.PhaseDecode, wrappers.PhaseValidate, wrappers.PhaseHandler, wrappers.PhaseEncode} {
+			assert.Contains(t, out, fmt.Sprintf(`test_phase_duration_seconds_count{method="POST",phase="%s",route="/users/:id"}`, phase))
+		}
+		assert.Contains(t, out, `test_request_duration_seconds_count{method="POST",route="/users/:id"} 3`)
+	})
+
+	t.Run("Tracks in-flight requests", func(t *testing.T) {
+		assert.Contains(t, out, `test_requests_in_flight{method="POST",route="/users/:id"} 0`)
+	})
+}
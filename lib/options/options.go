@@ -2,33 +2,82 @@ package options
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/jessevdk/go-flags"
+	log "github.com/sirupsen/logrus"
 )
 
 // Base are base API server options
 type Base struct {
-	Mode            string `short:"m" long:"mode" description:"Server mode" choice:"http" choice:"lambda" default:"http"`
-	BindAddress     string `short:"b" long:"address" description:"Address to bind API server" default:"0.0.0.0"`
-	Port            string `short:"p" long:"port" description:"Port on which to bind API server" default:"10001"`
-	ExternalAddress string `short:"e" long:"external-address" description:"External address for connection to server" default:"localhost:10001"`
-	StaticDir       string `short:"s" long:"static-dir" description:"Directory to serve static content from (if specified)"`
+	Mode            string   `short:"m" long:"mode" description:"Server mode" choice:"http" choice:"h2c" choice:"http3" choice:"lambda" choice:"cloudevents" choice:"function" default:"http"`
+	BindAddress     string   `short:"b" long:"address" description:"Address to bind API server" default:"0.0.0.0"`
+	Port            string   `short:"p" long:"port" description:"Port on which to bind API server" default:"10001"`
+	ExternalAddress string   `short:"e" long:"external-address" description:"External address for connection to server" default:"localhost:10001"`
+	Listen          []string `short:"l" long:"listen" description:"Listen addresses (tcp://host:port, unix:///path/to/socket or systemd for socket activation), replacing address and port if set"`
+	SocketMode      string   `long:"socket-mode" description:"File mode for unix domain sockets" default:"0660"`
+	GracefulRestart bool     `long:"graceful-restart" description:"Hand listeners to a new process and drain on SIGHUP or SIGUSR2"`
+	StaticDir       string   `short:"s" long:"static-dir" description:"Directory to serve static content from (if specified)"`
 
-	TLS `namespace:"tls" group:"Transport Layer Security (TLS) options"`
+	Limits  `namespace:"limits" group:"Server timeout and size limits"`
+	Admin   `namespace:"admin" group:"Internal admin listener options"`
+	Metrics `namespace:"metrics" group:"Prometheus metrics options"`
+	Tracing `namespace:"tracing" group:"OpenTelemetry tracing options"`
 
-	CookieSecret string `long:"cookie-secret" description:"Secret for session cookie encryption (defaults to a random key)"`
+	TLS  `namespace:"tls" group:"Transport Layer Security (TLS) options"`
+	ACME `namespace:"acme" group:"Automatic Certificate Management Environment (ACME) options"`
+
+	CookieSecret string `long:"cookie-secret" description:"Deprecated, use --cookie.secret"`
 	Session      `namespace:"cookie" group:"Session storage options"`
 
-	LogEndpoints bool `long:"log-endpoints" description:"Enable endpoint logging"`
+	LogEndpoints bool   `long:"log-endpoints" description:"Enable structured access logging"`
+	LogLevel     string `long:"log-level" description:"Log level" choice:"trace" choice:"debug" choice:"info" choice:"warn" choice:"error" default:"info"`
+	LogFormat    string `long:"log-format" description:"Log format" choice:"text" choice:"json" default:"text"`
+
+	// Logger used by all API components, configured from log level and format if not set
+	Logger log.FieldLogger `no-flag:"true"`
 
 	CORS `namespace:"cors" group:"Cross Origin Resource Sharing (CORS) settings"`
 	CSP  `namespace:"csp" group:"Content Security Policy (CSP) settings"`
+	HSTS `namespace:"hsts" group:"HTTP Strict Transport Security (HSTS) settings"`
+	CSRF `namespace:"csrf" group:"Cross Site Request Forgery (CSRF) protection settings"`
+
+	ContentTypeOptions `namespace:"content-type-options" group:"Content type sniffing (X-Content-Type-Options) settings"`
+	ReferrerPolicy     `namespace:"referrer-policy" group:"Referrer-Policy settings"`
+	PermissionsPolicy  `namespace:"permissions-policy" group:"Permissions-Policy settings"`
+	CrossOrigin        `namespace:"cross-origin" group:"Cross origin isolation (COOP, COEP and CORP) settings"`
+	FrameOptions       `namespace:"frame-options" group:"Framing (X-Frame-Options) settings"`
+}
+
+// GetLogger fetches the configured logger, creating a logger using the log level and format if not set
+func (b *Base) GetLogger() log.FieldLogger {
+	if b.Logger != nil {
+		return b.Logger
+	}
+
+	logger := log.New()
+	if level, err := log.ParseLevel(b.LogLevel); err == nil {
+		logger.SetLevel(level)
+	}
+	if b.LogFormat == LogFormatJSON {
+		logger.SetFormatter(&log.JSONFormatter{})
+	}
+	b.Logger = logger
+
+	return b.Logger
 }
 
 func (b *Base) GetExternalAddress() string {
-	if b.TLS.NoTLS {
+	if strings.Contains(b.ExternalAddress, "://") {
+		return b.ExternalAddress
+	} else if b.TLS.NoTLS {
 		return fmt.Sprintf("http://%s", b.ExternalAddress)
 	} else {
 		return fmt.Sprintf("https://%s", b.ExternalAddress)
@@ -44,26 +93,165 @@ func (b *Base) GetBindAddress() string {
 }
 
 type Session struct {
-	Secret        string `long:"secret" description:"Secret for session cookie encryption (defaults to a random key)"`
+	Secret        string `long:"secret" env:"SESSION_SECRET" description:"Secret for signing session cookies, or file:PATH or env:NAME to load the secret (defaults to a random key)"`
+	EncryptionKey string `long:"encryption-key" env:"SESSION_ENCRYPTION_KEY" description:"Key for encrypting session cookies, or file:PATH or env:NAME to load the key (defaults to a random key where the secret is random)"`
 	DisableSecure bool   `long:"disable-secure" description:"Disable secure cookie flag (DEV USE ONLY)"`
+
+	PreviousSecrets        []string `long:"previous-secret" description:"Previous signing secrets, accepted for verification during rotation (file:PATH or env:NAME supported)"`
+	PreviousEncryptionKeys []string `long:"previous-encryption-key" description:"Previous encryption keys, paired with previous secrets by position (file:PATH or env:NAME supported)"`
+	RequireSecret          bool     `long:"require-secret" description:"Fail at startup where no secret is configured (implied for serverless modes)"`
+
+	Backend     string        `long:"backend" description:"Session storage backend (custom backends may be attached via API.SetSessionStore)" choice:"cookie" choice:"memory" choice:"filesystem" default:"cookie"`
+	Dir         string        `long:"dir" description:"Directory for filesystem session storage" default:"sessions"`
+	MaxIdle     time.Duration `long:"max-idle" description:"Duration after which server-side sessions expire without use (0 for no limit)" default:"30m"`
+	MaxLifetime time.Duration `long:"max-lifetime" description:"Duration after which sessions expire regardless of use (defaults to 24h for server-side sessions, and the 30 day cookie max age for cookie sessions)"`
 }
 
+// Session backend constants
+const (
+	SessionBackendCookie     = "cookie"
+	SessionBackendMemory     = "memory"
+	SessionBackendFilesystem = "filesystem"
+)
+
+// DefaultSessionLifetime is the lifetime of server-side sessions where no maximum lifetime is set
+const DefaultSessionLifetime = 24 * time.Hour
+
 // TLS configuration options
 type TLS struct {
 	TLSCert string `short:"c" long:"cert" description:"TLS certificate file"`
 	TLSKey  string `short:"k" long:"key" description:"TLS key file"`
 	NoTLS   bool   `long:"disable" description:"Disable TLS"`
+
+	ClientCAs       []string `long:"client-ca" description:"CA bundle(s) used to verify client certificates"`
+	ClientAuth      string   `long:"client-auth" description:"Client certificate mode" choice:"none" choice:"request" choice:"require" choice:"verify-if-given" choice:"verify" default:"none"`
+	AllowedSubjects []string `long:"allowed-subject" description:"Allowed client certificate subject patterns, matching common name or full subject (requires a verifying client-auth mode)"`
+	AllowedSANs     []string `long:"allowed-san" description:"Allowed client certificate subject alternative name patterns (requires a verifying client-auth mode)"`
+
+	MinVersion       string        `long:"min-version" description:"Minimum TLS version" choice:"1.0" choice:"1.1" choice:"1.2" choice:"1.3" default:"1.2"`
+	CipherSuites     []string      `long:"cipher-suite" description:"Allowed TLS 1.0-1.2 cipher suites (defaults to ECDHE AEAD suites)"`
+	CurvePreferences []string      `long:"curve" description:"Preferred elliptic curves" choice:"X25519" choice:"P256" choice:"P384" choice:"P521"`
+	ReloadInterval   time.Duration `long:"reload-interval" description:"Interval at which to check certificate and key files for changes (0 to disable)" default:"1m"`
+}
+
+// Limits configuration options
+type Limits struct {
+	ReadTimeout       time.Duration `long:"read-timeout" description:"Maximum duration for reading an entire request (0 to disable)" default:"30s"`
+	ReadHeaderTimeout time.Duration `long:"read-header-timeout" description:"Maximum duration for reading request headers (0 to disable)" default:"10s"`
+	WriteTimeout      time.Duration `long:"write-timeout" description:"Maximum duration before timing out writes of a response (0 to disable)" default:"60s"`
+	IdleTimeout       time.Duration `long:"idle-timeout" description:"Maximum duration to wait for the next request on keep-alive connections" default:"2m"`
+	MaxHeaderBytes    int           `long:"max-header-bytes" description:"Maximum size of request headers in bytes" default:"1048576"`
+	MaxBodySize       int64         `long:"max-body-size" description:"Default maximum size of decoded request bodies in bytes (0 to disable)" default:"10485760"`
+}
+
+// Admin listener configuration options
+type Admin struct {
+	Address string `long:"address" description:"Address to bind the internal admin listener for health, metrics and debug endpoints (disabled if empty)"`
+	Pprof   bool   `long:"pprof" description:"Enable pprof debug endpoints on the admin listener"`
+	Public  bool   `long:"public" description:"Serve admin endpoints (except pprof) on the public listener where no admin address is configured, for requests not matching API routes (NOT RECOMMENDED)"`
+}
+
+// Metrics configuration options
+type Metrics struct {
+	Path      string `long:"path" description:"Path at which to serve Prometheus metrics on the admin listener" default:"/metrics"`
+	Namespace string `long:"namespace" description:"Namespace prefix for metric names" default:"goapi"`
+	NoMetrics bool   `long:"disable" description:"Disable endpoint metrics"`
+	Public    bool   `long:"public" description:"Also serve metrics on the public listener where --admin.public is set (NOT RECOMMENDED)"`
+}
+
+// Tracing configuration options
+type Tracing struct {
+	Exporter    string  `long:"exporter" description:"Span exporter (custom exporters may be attached via API.Tracing)" choice:"none" choice:"stdout" default:"none"`
+	ServiceName string  `long:"service-name" description:"Service name reported in traces" default:"go-api"`
+	SampleRatio float64 `long:"sample-ratio" description:"Ratio of new traces to sample (incoming sampling decisions are respected)" default:"1.0"`
+	NoTracing   bool    `long:"disable" description:"Disable tracing"`
+}
+
+// Tracing exporter constants
+const (
+	TraceExporterNone   = "none"
+	TraceExporterStdout = "stdout"
+)
+
+// HSTS configuration options
+type HSTS struct {
+	MaxAge            time.Duration `long:"max-age" description:"Duration for which clients should only connect via TLS" default:"8760h"`
+	IncludeSubdomains bool          `long:"include-subdomains" description:"Apply HSTS policy to subdomains"`
+	Preload           bool          `long:"preload" description:"Allow inclusion in browser HSTS preload lists"`
+	NoHSTS            bool          `long:"disable" description:"Disable HSTS headers"`
+}
+
+// CSRF configuration options
+type CSRF struct {
+	SessionName    string   `long:"session-name" description:"Name of the session storing CSRF secrets" default:"_csrf"`
+	SessionCookies []string `long:"session-cookies" description:"Additional cookies authenticating requests, where unsafe requests carrying these are checked (registered sessions and session authenticators are included automatically)"`
+	HeaderName     string   `long:"header" description:"Request header containing CSRF tokens" default:"X-CSRF-Token"`
+	FieldName      string   `long:"field" description:"Form field containing CSRF tokens" default:"csrf_token"`
+	TrustedOrigins []string `long:"trusted-origins" description:"Additional origins permitted to make requests, supporting wildcards as with CORS origins"`
+	NoCSRF         bool     `long:"disable" description:"Disable CSRF protection"`
+	// Exempt disables CSRF protection for a route (see security.CSRFExempt), along with session authentication
+	Exempt bool `no-flag:"true"`
+}
+
+// ContentTypeOptions configuration options
+type ContentTypeOptions struct {
+	NoContentTypeOptions bool `long:"disable" description:"Disable X-Content-Type-Options: nosniff header"`
+}
+
+// ReferrerPolicy configuration options
+type ReferrerPolicy struct {
+	Referrer         string `long:"policy" description:"Referrer policy" choice:"no-referrer" choice:"no-referrer-when-downgrade" choice:"origin" choice:"origin-when-cross-origin" choice:"same-origin" choice:"strict-origin" choice:"strict-origin-when-cross-origin" choice:"unsafe-url" default:"strict-origin-when-cross-origin"`
+	NoReferrerPolicy bool   `long:"disable" description:"Disable Referrer-Policy header"`
+}
+
+// PermissionsPolicy configuration options
+type PermissionsPolicy struct {
+	Permissions         []string `long:"policy" description:"Permissions policy directives (ie. camera=(self))" default:"camera=()" default:"microphone=()" default:"geolocation=()" default:"payment=()" default:"usb=()"`
+	NoPermissionsPolicy bool     `long:"disable" description:"Disable Permissions-Policy header"`
+}
+
+// CrossOrigin configuration options
+type CrossOrigin struct {
+	OpenerPolicy   string `long:"opener-policy" description:"Cross-Origin-Opener-Policy (empty to omit)" default:"same-origin"`
+	EmbedderPolicy string `long:"embedder-policy" description:"Cross-Origin-Embedder-Policy (ie. require-corp, empty to omit)"`
+	ResourcePolicy string `long:"resource-policy" description:"Cross-Origin-Resource-Policy (empty to omit)" default:"same-origin"`
+	NoCrossOrigin  bool   `long:"disable" description:"Disable cross origin isolation headers"`
+}
+
+// FrameOptions configuration options
+type FrameOptions struct {
+	Frame          string `long:"policy" description:"Frame options" choice:"DENY" choice:"SAMEORIGIN" default:"DENY"`
+	NoFrameOptions bool   `long:"disable" description:"Disable X-Frame-Options header"`
+}
+
+// ACME configuration options
+type ACME struct {
+	Enabled      bool     `long:"enable" description:"Enable automatic TLS certificates via ACME (replaces tls.cert and tls.key)"`
+	DirectoryURL string   `long:"directory" description:"ACME directory URL" default:"https://acme-v02.api.letsencrypt.org/directory"`
+	CACert       string   `long:"ca-cert" description:"CA certificate to trust for the ACME directory (for local test CAs such as Pebble)"`
+	CacheDir     string   `long:"cache-dir" description:"Directory in which to cache issued certificates" default:"./certs"`
+	Email        string   `long:"email" description:"Contact email for the ACME account"`
+	Hosts        []string `long:"host" description:"Hosts for which certificates may be requested (defaults to external address host)"`
+	HTTPAddress  string   `long:"http-address" description:"Address to bind the HTTP-01 challenge listener (disabled if empty)" default:":80"`
 }
 
 // CORS configuration options
 type CORS struct {
-	AllowedOrigins   []string `long:"allowed-origins" description:"Allowed origins (defaults to external address or bind address)"`
-	AllowedMethods   []string `long:"allowed-methods" description:"Allowed http methods" default:"GET,POST,PUT,UPDATE,OPTIONS"`
-	AllowedHeaders   []string `long:"allowed-headers" description:"Allowed headers" default:"Content-Type"`
-	AllowCredentials bool     `long:"allowed-credentials" description:"Allowed credentials"`
-	NoCORS           bool     `long:"disable" description:"Disable CORS headers"`
+	AllowedOrigins   []string      `long:"allowed-origins" description:"Allowed origins, supporting '*', subdomain wildcards (https://*.example.com) and 'regex:' patterns (defaults to external address)"`
+	AllowedMethods   []string      `long:"allowed-methods" description:"Allowed http methods (GET, HEAD and POST are always allowed)" default:"GET" default:"HEAD" default:"POST" default:"PUT" default:"OPTIONS"`
+	AllowedHeaders   []string      `long:"allowed-headers" description:"Allowed headers" default:"Content-Type"`
+	ExposedHeaders   []string      `long:"exposed-headers" description:"Response headers exposed to clients"`
+	AllowCredentials bool          `long:"allowed-credentials" description:"Allowed credentials"`
+	MaxAge           time.Duration `long:"max-age" description:"Duration for which clients may cache preflight responses (0 to omit)"`
+	NoCORS           bool          `long:"disable" description:"Disable CORS headers"`
+
+	// OriginValidator validates origins not matched by AllowedOrigins (ie. per-tenant origins)
+	OriginValidator OriginValidator `no-flag:"true"`
 }
 
+// OriginValidator checks whether a CORS origin is allowed for the provided request
+type OriginValidator func(req *http.Request, origin string) bool
+
 // CSP configuration options
 type CSP struct {
 	ReportOnly  bool     `long:"report-only" description:"Sets CSP to report only mode"`
@@ -81,12 +269,39 @@ type CSP struct {
 	WorkerSrc   []string `long:"worker-src" description:"Allowed worker sources"`
 	ReportTo    string   `long:"report-to" description:"ReportTo address" default:"/csp-report"`
 	NoCSP       bool     `long:"disable" description:"Disable CSP headers"`
+
+	Nonce         bool `long:"nonce" description:"Generate a per-request nonce for inline scripts and styles"`
+	StrictDynamic bool `long:"strict-dynamic" description:"Allow scripts loaded by trusted scripts ('strict-dynamic')"`
+	HashStatic    bool `long:"hash-static" description:"Allow inline scripts and styles in static HTML files by hash"`
+
+	ReportRate   float64       `long:"report-rate" description:"Maximum violation reports accepted per second where received locally (0 for unlimited)" default:"10"`
+	ReportDedupe time.Duration `long:"report-dedupe" description:"Window in which duplicate violation reports are dropped" default:"1m"`
 }
 
+// Log format constants
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// Client certificate mode constants
+const (
+	ClientAuthNone          = "none"
+	ClientAuthRequest       = "request"
+	ClientAuthRequire       = "require"
+	ClientAuthVerifyIfGiven = "verify-if-given"
+	ClientAuthVerify        = "verify"
+)
+
 // Server mode constants
 const (
 	ModeLambda = "lambda"
 	ModeHTTP   = "http"
+	ModeH2C    = "h2c"
+	ModeHTTP3  = "http3"
+
+	ModeCloudEvents = "cloudevents"
+	ModeFunction    = "function"
 )
 
 // Parse parses command line options
@@ -95,6 +310,70 @@ func Parse(i interface{}) error {
 	return err
 }
 
+// Secret source prefixes
+const (
+	SecretFilePrefix = "file:"
+	SecretEnvPrefix  = "env:"
+)
+
+// ResolveSecret resolves a secret value, loading secrets prefixed with file: from the named file
+// (trimming trailing whitespace) and secrets prefixed with env: from the named environment variable
+func ResolveSecret(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, SecretFilePrefix):
+		data, err := ioutil.ReadFile(strings.TrimPrefix(value, SecretFilePrefix))
+		if err != nil {
+			return "", fmt.Errorf("Error reading secret file (%s)", err)
+		}
+		return strings.TrimRight(string(data), "\r\n\t "), nil
+	case strings.HasPrefix(value, SecretEnvPrefix):
+		name := strings.TrimPrefix(value, SecretEnvPrefix)
+		secret, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("Secret environment variable '%s' not set", name)
+		}
+		return secret, nil
+	default:
+		return value, nil
+	}
+}
+
+// KeyPairs resolves the session signing secrets and encryption keys into key pairs
+// for gorilla/securecookie, with the current pair first followed by any previous pairs.
+// Encryption keys are derived from the configured values using SHA256 to provide AES-256 keys.
+func (s *Session) KeyPairs() ([][]byte, error) {
+	secrets := append([]string{s.Secret}, s.PreviousSecrets...)
+	keys := append([]string{s.EncryptionKey}, s.PreviousEncryptionKeys...)
+	if len(keys) > len(secrets) {
+		return nil, fmt.Errorf("More encryption keys than secrets provided")
+	}
+
+	pairs := make([][]byte, 0, 2*len(secrets))
+	for i := range secrets {
+		secret, err := ResolveSecret(secrets[i])
+		if err != nil {
+			return nil, err
+		}
+		if secret == "" {
+			return nil, fmt.Errorf("Session secret %d is empty", i)
+		}
+
+		var key []byte
+		if i < len(keys) && keys[i] != "" {
+			k, err := ResolveSecret(keys[i])
+			if err != nil {
+				return nil, err
+			}
+			sum := sha256.Sum256([]byte(k))
+			key = sum[:]
+		}
+
+		pairs = append(pairs, []byte(secret), key)
+	}
+
+	return pairs, nil
+}
+
 // GenerateSecret Helper to generate a default secret to use
 func GenerateSecret(len int) (string, error) {
 	data := make([]byte, len)
@@ -9,10 +9,11 @@ type LogPlugin struct {
 	logger log.FieldLogger
 }
 
-// NewLogPlugin Create a new registration logging plugin instance
-func NewLogPlugin() *LogPlugin {
+// NewLogPlugin Create a new registration logging plugin instance using the provided logger
+// (see options.Base.GetLogger)
+func NewLogPlugin(logger log.FieldLogger) *LogPlugin {
 	return &LogPlugin{
-		logger: log.New().WithField("module", "log-plugin"),
+		logger: logger.WithField("module", "log-plugin"),
 	}
 }
 
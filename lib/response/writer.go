@@ -0,0 +1,90 @@
+// Package response provides a response writer recording the status and size of responses,
+// passing through optional interfaces (http.Flusher, http.Hijacker and http.Pusher)
+// so streaming, server sent events and websocket upgrades continue to work when wrapped.
+package response
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+)
+
+// Writer wraps an http.ResponseWriter, recording the first status and the number of bytes written
+type Writer struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+// NewWriter creates a response writer wrapping the provided writer
+func NewWriter(rw http.ResponseWriter) *Writer {
+	return &Writer{ResponseWriter: rw}
+}
+
+// Status fetches the status written to the response (0 where nothing has been written)
+func (w *Writer) Status() int {
+	return w.status
+}
+
+// Size fetches the number of body bytes written to the response
+func (w *Writer) Size() int {
+	return w.size
+}
+
+// Written reports whether a status or body has been written to the response
+func (w *Writer) Written() bool {
+	return w.status != 0
+}
+
+func (w *Writer) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *Writer) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.size += n
+	return n, err
+}
+
+// Flush flushes buffered data to the client where supported by the underlying writer
+func (w *Writer) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		f.Flush()
+	}
+}
+
+// Hijack takes over the underlying connection where supported (ie. for websocket upgrades)
+func (w *Writer) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil && w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// Push initiates an HTTP/2 server push where supported
+func (w *Writer) Push(target string, opts *http.PushOptions) error {
+	p, ok := w.ResponseWriter.(http.Pusher)
+	if !ok {
+		return http.ErrNotSupported
+	}
+	return p.Push(target, opts)
+}
+
+// Unwrap fetches the underlying writer, for use with http.ResponseController
+func (w *Writer) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
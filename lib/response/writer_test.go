@@ -0,0 +1,78 @@
+package response
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// hijackRecorder is a response recorder supporting connection hijacking
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+}
+
+func (r *hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	r.hijacked = true
+	return nil, nil, nil
+}
+
+func TestWriter(t *testing.T) {
+	t.Run("Records the first status written", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		w := NewWriter(rec)
+
+		w.WriteHeader(http.StatusNotFound)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("missing"))
+
+		assert.Equal(t, http.StatusNotFound, w.Status())
+		assert.Equal(t, len("missing"), w.Size())
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("Defaults status on write", func(t *testing.T) {
+		w := NewWriter(httptest.NewRecorder())
+		assert.False(t, w.Written())
+
+		w.Write([]byte("ok"))
+		assert.Equal(t, http.StatusOK, w.Status())
+		assert.True(t, w.Written())
+	})
+
+	t.Run("Passes through flushes", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		var rw http.ResponseWriter = NewWriter(rec)
+
+		f, ok := rw.(http.Flusher)
+		require.True(t, ok)
+		f.Flush()
+		assert.True(t, rec.Flushed)
+	})
+
+	t.Run("Passes through hijacking where supported", func(t *testing.T) {
+		rec := &hijackRecorder{ResponseRecorder: httptest.NewRecorder()}
+		w := NewWriter(rec)
+
+		_, _, err := w.Hijack()
+		require.Nil(t, err)
+		assert.True(t, rec.hijacked)
+		assert.Equal(t, http.StatusSwitchingProtocols, w.Status())
+
+		_, _, err = NewWriter(httptest.NewRecorder()).Hijack()
+		assert.Equal(t, http.ErrNotSupported, err)
+	})
+
+	t.Run("Supports response controllers", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		rc := http.NewResponseController(NewWriter(rec))
+
+		require.Nil(t, rc.Flush())
+		assert.True(t, rec.Flushed)
+	})
+}
@@ -2,7 +2,9 @@ package router
 
 // Endpoint for internal use
 type endpoint struct {
-	path string
+	path   string
+	route  string
+	method string
 	// Input object
 	i interface{}
 	// Output object
@@ -12,3 +14,9 @@ type endpoint struct {
 	// Wrapped function
 	w interface{}
 }
+
+// Route describes a route registered via RegisterEndpoint
+type Route struct {
+	Path   string `json:"path"`
+	Method string `json:"method"`
+}
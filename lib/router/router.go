@@ -3,11 +3,13 @@ package router
 import (
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/gocraft/web"
 
 	log "github.com/sirupsen/logrus"
 
+	"github.com/ryankurte/go-api/lib/security"
 	"github.com/ryankurte/go-api/lib/wrappers"
 )
 
@@ -19,20 +21,33 @@ type Router struct {
 	ctx interface{}
 	// Path of the current router
 	path string
+	// Full path prefix of the current router (including parent paths)
+	prefix string
 	// Endpoints attached to the router
 	endpoints []endpoint
 	// Error handling function attached to the router
 	errorHandler wrappers.ErrorHandler
+	// Default arguments passed to endpoint wrappers
+	args []interface{}
+	// Subrouters created from this router
+	children []*Router
+	// Logger for router events
+	logger log.FieldLogger
+	// Security policy overrides (shared with subrouters)
+	policies *security.PolicySet
 }
 
 // New Creates an API router instance (internal use only)
-func New(router *web.Router, ctx interface{}, path string) Router {
+func New(router *web.Router, ctx interface{}, path string, logger log.FieldLogger) Router {
 	return Router{
 		router:       router,
 		ctx:          ctx,
 		path:         path,
+		prefix:       strings.TrimSuffix(path, "/"),
 		endpoints:    make([]endpoint, 0),
 		errorHandler: wrappers.DefaultErrorHandler,
+		logger:       logger,
+		policies:     security.NewPolicySet(),
 	}
 }
 
@@ -42,34 +57,73 @@ func wrapGocraft(h wrappers.HTTPHandler) func(ctx interface{}, rw web.ResponseWr
 	}
 }
 
+// SetLogger sets the logger used by this router and any subrouters subsequently created from it
+func (r *Router) SetLogger(logger log.FieldLogger) {
+	r.logger = logger
+}
+
+// SetDefaultArgs sets default arguments passed to endpoint wrappers (see wrappers.BuildEndpoint)
+// for endpoints subsequently registered on this router and any subrouters created from it.
+func (r *Router) SetDefaultArgs(args ...interface{}) {
+	r.args = args
+}
+
+// SetPolicy overrides CORS, CSP and CSRF options for all routes on this router and any subrouters
+func (r *Router) SetPolicy(opts ...security.PolicyOption) {
+	r.policies.AddPrefix(r.prefix, opts...)
+}
+
+// Policies fetches the security policy overrides for this router and any subrouters
+func (r *Router) Policies() *security.PolicySet {
+	return r.policies
+}
+
 // RegisterEndpoint Register a route to the API router.
 // This takes a typed endpoint and generates a wrapper to handle
 // translation and validation of input and output structures,
 // as well as error handling for the endpoint.
-func (r *Router) RegisterEndpoint(route string, method string, f interface{}) error {
+// args are passed to the endpoint wrapper, overriding any default arguments (see wrappers.BuildEndpoint),
+// and may include security.PolicyOptions to override CORS, CSP and CSRF options for the endpoint.
+func (r *Router) RegisterEndpoint(route string, method string, f interface{}, args ...interface{}) error {
 
-	log.Infof("Router '%s' attaching route %s with method %s (f: %+V)", r.path, route, method, f)
+	r.logger.Infof("Router '%s' attaching route %s with method %s (f: %+V)", r.path, route, method, f)
 
 	var w interface{}
 
+	// Bind security policy overrides
+	opts := make([]security.PolicyOption, 0)
+	for _, a := range args {
+		if o, ok := a.(security.PolicyOption); ok {
+			opts = append(opts, o)
+		}
+	}
+	if len(opts) > 0 {
+		r.policies.AddRoute(r.fullPath(route), method, opts...)
+	}
+
 	// Build endpoint wrapper
-	h, err := wrappers.BuildEndpoint(method, f)
+	wrapperArgs := []interface{}{r.errorHandler, wrappers.Endpoint{Route: r.fullPath(route), Method: method}}
+	wrapperArgs = append(wrapperArgs, r.args...)
+	wrapperArgs = append(wrapperArgs, args...)
+	h, err := wrappers.BuildEndpoint(method, f, wrapperArgs...)
 	if err != nil {
 		return err
 	}
 	w = wrapGocraft(h)
 
 	// Fetch endpoint input/output instances
-	inType, outType := wrappers.GetTypes(f)
+	inType, outType := wrappers.GetTypes(f, wrapperArgs...)
 
 	// Save endpoint object for later traversal
 	path := fmt.Sprintf("%s/%s:%s", r.path, route, method)
 	r.endpoints = append(r.endpoints, endpoint{
-		path: path,
-		i:    inType,
-		o:    outType,
-		f:    f,
-		w:    w,
+		path:   path,
+		route:  route,
+		method: method,
+		i:      inType,
+		o:      outType,
+		f:      f,
+		w:      w,
 	})
 
 	// Bind to router
@@ -79,7 +133,7 @@ func (r *Router) RegisterEndpoint(route string, method string, f interface{}) er
 // Register registers a basic http or gocraft/web route handler without any modification
 // This does not currently call any meta plugins.
 func (r *Router) Register(route string, method string, f interface{}) error {
-	log.Infof("Router '%s' attaching route '%s' with method '%s' (f: %+V)", r.path, route, method, f)
+	r.logger.Infof("Router '%s' attaching route '%s' with method '%s' (f: %+V)", r.path, route, method, f)
 
 	switch method {
 	case http.MethodGet:
@@ -97,7 +151,7 @@ func (r *Router) Register(route string, method string, f interface{}) error {
 	case http.MethodOptions:
 		r.router = r.router.Options(route, f)
 	default:
-		log.Errorf("Invalid HTTP method: %s", method)
+		r.logger.Errorf("Invalid HTTP method: %s", method)
 		return fmt.Errorf("Invalid HTTP method: %s", method)
 	}
 
@@ -111,11 +165,34 @@ func (r *Router) Subrouter(ctx interface{}, path string) *Router {
 	b := r.router.Subrouter(ctx, path)
 
 	// Create API Router instance
-	sr := New(b, ctx, path)
+	sr := New(b, ctx, path, r.logger)
+	sr.prefix = r.prefix + sr.prefix
+	sr.errorHandler = r.errorHandler
+	sr.args = r.args
+	sr.policies = r.policies
+	r.children = append(r.children, &sr)
 
 	return &sr
 }
 
+// Routes lists endpoints registered on this router and any subrouters
+func (r *Router) Routes() []Route {
+	routes := make([]Route, 0)
+	for _, e := range r.endpoints {
+		routes = append(routes, Route{Path: r.fullPath(e.route), Method: e.method})
+	}
+	for _, c := range r.children {
+		routes = append(routes, c.Routes()...)
+	}
+
+	return routes
+}
+
+// fullPath builds the full route template for a route on this router
+func (r *Router) fullPath(route string) string {
+	return r.prefix + "/" + strings.TrimPrefix(route, "/")
+}
+
 // RegisterMiddleware Attach dependency injected middleware to API router.
 // This is not yet supported
 func (r *Router) RegisterMiddleware() error {
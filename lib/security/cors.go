@@ -1,31 +1,181 @@
 package security
 
 import (
+	"fmt"
 	"net/http"
-
-	"github.com/gorilla/handlers"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/ryankurte/go-api/lib/options"
 )
 
-// CORS builds a Cross-Origin Resource Sharing (COS) handler around the provided handler
-// with the specified options
+// CORS origin pattern constants
+const (
+	CORSOriginMatchAll    = "*"
+	CORSOriginRegexPrefix = "regex:"
+)
+
+// Headers that are always allowed in CORS requests
+var corsSimpleHeaders = []string{"Accept", "Accept-Language", "Content-Language", "Origin"}
+
+// Methods that are always allowed in CORS requests
+var corsSimpleMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+
+// originMatcher matches CORS origins against exact origins, subdomain wildcards, regexes and a validator
+type originMatcher struct {
+	all       bool
+	exact     []string
+	patterns  []*regexp.Regexp
+	validator options.OriginValidator
+}
+
+// newOriginMatcher compiles the provided origin patterns
+func newOriginMatcher(origins []string, validator options.OriginValidator) (*originMatcher, error) {
+	m := originMatcher{exact: make([]string, 0), patterns: make([]*regexp.Regexp, 0), validator: validator}
+
+	for _, o := range origins {
+		switch {
+		case o == CORSOriginMatchAll:
+			m.all = true
+		case strings.HasPrefix(o, CORSOriginRegexPrefix):
+			// Regexes must match the whole origin
+			r, err := regexp.Compile("^(?:" + strings.TrimPrefix(o, CORSOriginRegexPrefix) + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("Invalid CORS origin pattern '%s' (%s)", o, err)
+			}
+			m.patterns = append(m.patterns, r)
+		case strings.Contains(o, "*"):
+			// Wildcards match one or more subdomain labels
+			pattern := strings.Replace(regexp.QuoteMeta(o), `\*`, `[a-z0-9-]+(\.[a-z0-9-]+)*`, -1)
+			m.patterns = append(m.patterns, regexp.MustCompile("(?i)^"+pattern+"$"))
+		default:
+			m.exact = append(m.exact, strings.TrimSuffix(o, "/"))
+		}
+	}
+
+	return &m, nil
+}
+
+// Match checks whether an origin is allowed for the provided request
+func (m *originMatcher) Match(req *http.Request, origin string) bool {
+	if m.all {
+		return true
+	}
+	for _, o := range m.exact {
+		if strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	for _, p := range m.patterns {
+		if p.MatchString(origin) {
+			return true
+		}
+	}
+	return m.validator != nil && m.validator(req, origin)
+}
+
+func matchesAny(list []string, value string) bool {
+	for _, v := range list {
+		if v == CORSOriginMatchAll || strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// CORS builds a Cross-Origin Resource Sharing (CORS) handler around the provided handler
+// with the specified options. Where no origins or validator are specified the external address is allowed.
 func CORS(h http.Handler, o *options.Base) http.Handler {
-	if len(o.AllowedOrigins) == 0 {
-		o.AllowedOrigins = []string{o.ExternalAddress}
+	if o.NoCORS {
+		return h
 	}
 
-	config := []handlers.CORSOption{
-		handlers.AllowedOrigins(o.AllowedOrigins),
-		handlers.AllowedMethods(o.AllowedMethods),
-		handlers.AllowedHeaders(o.AllowedHeaders),
+	logger := o.GetLogger().WithField("module", "cors")
+
+	origins := o.AllowedOrigins
+	if len(origins) == 0 && o.OriginValidator == nil {
+		origins = []string{o.GetExternalAddress()}
 	}
 
-	if o.AllowCredentials {
-		config = append(config, handlers.AllowCredentials())
+	matcher, err := newOriginMatcher(origins, o.OriginValidator)
+	if err != nil {
+		// Fail closed, allowing only the validator (if set)
+		logger.Errorf("Error parsing CORS origins (%s)", err)
+		matcher = &originMatcher{validator: o.OriginValidator}
 	}
 
-	CORSHandler := handlers.CORS(config...)
+	// Responses vary by origin unless all origins are allowed without credentials
+	varyOrigin := !matcher.all || o.AllowCredentials
+
+	allowedMethods := strings.Join(o.AllowedMethods, ", ")
+	exposedHeaders := strings.Join(o.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(o.CORS.MaxAge.Seconds()))
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		origin := req.Header.Get("Origin")
+		preflight := req.Method == http.MethodOptions && req.Header.Get("Access-Control-Request-Method") != ""
+
+		if varyOrigin {
+			rw.Header().Add("Vary", "Origin")
+		}
+		if preflight {
+			rw.Header().Add("Vary", "Access-Control-Request-Method")
+			rw.Header().Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		if origin == "" || !matcher.Match(req, origin) {
+			if preflight {
+				rw.WriteHeader(http.StatusForbidden)
+				return
+			}
+			h.ServeHTTP(rw, req)
+			return
+		}
+
+		if matcher.all && !o.AllowCredentials {
+			rw.Header().Set("Access-Control-Allow-Origin", CORSOriginMatchAll)
+		} else {
+			rw.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+		if o.AllowCredentials {
+			rw.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			if exposedHeaders != "" {
+				rw.Header().Set("Access-Control-Expose-Headers", exposedHeaders)
+			}
+			h.ServeHTTP(rw, req)
+			return
+		}
+
+		// Respond to preflight requests
+		if method := req.Header.Get("Access-Control-Request-Method"); !matchesAny(corsSimpleMethods, method) && !matchesAny(o.AllowedMethods, method) {
+			rw.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		headers := make([]string, 0)
+		for _, v := range strings.Split(req.Header.Get("Access-Control-Request-Headers"), ",") {
+			header := http.CanonicalHeaderKey(strings.TrimSpace(v))
+			if header == "" || matchesAny(corsSimpleHeaders, header) {
+				continue
+			}
+			if !matchesAny(o.AllowedHeaders, header) {
+				rw.WriteHeader(http.StatusForbidden)
+				return
+			}
+			headers = append(headers, header)
+		}
 
-	return CORSHandler(h)
+		rw.Header().Set("Access-Control-Allow-Methods", allowedMethods)
+		if len(headers) > 0 {
+			rw.Header().Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+		}
+		if o.CORS.MaxAge > 0 {
+			rw.Header().Set("Access-Control-Max-Age", maxAge)
+		}
+		rw.WriteHeader(http.StatusNoContent)
+	})
 }
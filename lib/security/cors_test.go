@@ -0,0 +1,166 @@
+package security
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ryankurte/go-api/lib/options"
+)
+
+func TestCORS(t *testing.T) {
+	request := func(h http.Handler, method, origin string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, req)
+		return rw
+	}
+
+	newOptions := func() *options.Base {
+		o := options.Base{}
+		o.AllowedMethods = []string{http.MethodGet, http.MethodPost}
+		o.AllowedHeaders = []string{"Content-Type"}
+		return &o
+	}
+
+	t.Run("Defaults to the external address with scheme", func(t *testing.T) {
+		o := newOptions()
+		o.ExternalAddress = "api.example.com"
+		h := CORS(http.NotFoundHandler(), o)
+
+		rw := request(h, http.MethodGet, "https://api.example.com", nil)
+		assert.Equal(t, "https://api.example.com", rw.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "Origin", rw.Header().Get("Vary"))
+
+		rw = request(h, http.MethodGet, "https://other.com", nil)
+		assert.Equal(t, "", rw.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "Origin", rw.Header().Get("Vary"))
+	})
+
+	t.Run("Matches wildcard and regex origins", func(t *testing.T) {
+		o := newOptions()
+		o.AllowedOrigins = []string{"https://*.example.com", `regex:^https://tenant-[0-9]+\.example\.org$`, `regex:https://.*\.example\.net`}
+		h := CORS(http.NotFoundHandler(), o)
+
+		tests := map[string]bool{
+			"https://app.example.com":        true,
+			"https://a.b.example.com":        true,
+			"https://example.com":            false,
+			"http://app.example.com":         false,
+			"https://app.example.com.evil":   false,
+			"https://tenant-12.example.org":  true,
+			"https://tenant-x.example.org":   false,
+			"https://a.example.net":          true,
+			"https://a.example.net.evil.com": false,
+			"evil://https://a.example.net":   false,
+		}
+		for origin, allowed := range tests {
+			rw := request(h, http.MethodGet, origin, nil)
+			if allowed {
+				assert.Equal(t, origin, rw.Header().Get("Access-Control-Allow-Origin"), origin)
+			} else {
+				assert.Equal(t, "", rw.Header().Get("Access-Control-Allow-Origin"), origin)
+			}
+		}
+	})
+
+	t.Run("Validates origins with callback", func(t *testing.T) {
+		o := newOptions()
+		o.OriginValidator = func(req *http.Request, origin string) bool {
+			return origin == "https://tenant.com"
+		}
+		h := CORS(http.NotFoundHandler(), o)
+
+		rw := request(h, http.MethodGet, "https://tenant.com", nil)
+		assert.Equal(t, "https://tenant.com", rw.Header().Get("Access-Control-Allow-Origin"))
+
+		rw = request(h, http.MethodGet, "https://localhost:10001", nil)
+		assert.Equal(t, "", rw.Header().Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("Allows all origins", func(t *testing.T) {
+		o := newOptions()
+		o.AllowedOrigins = []string{"*"}
+		o.ExposedHeaders = []string{"X-Request-ID"}
+		h := CORS(http.NotFoundHandler(), o)
+
+		rw := request(h, http.MethodGet, "https://any.com", nil)
+		assert.Equal(t, "*", rw.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "X-Request-ID", rw.Header().Get("Access-Control-Expose-Headers"))
+		assert.Equal(t, "", rw.Header().Get("Vary"))
+
+		o.AllowCredentials = true
+		h = CORS(http.NotFoundHandler(), o)
+
+		rw = request(h, http.MethodGet, "https://any.com", nil)
+		assert.Equal(t, "https://any.com", rw.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "true", rw.Header().Get("Access-Control-Allow-Credentials"))
+		assert.Equal(t, "Origin", rw.Header().Get("Vary"))
+	})
+
+	t.Run("Responds to preflight requests", func(t *testing.T) {
+		o := newOptions()
+		o.AllowedOrigins = []string{"https://app.com"}
+		o.CORS.MaxAge = 10 * time.Minute
+		h := CORS(http.NotFoundHandler(), o)
+
+		rw := request(h, http.MethodOptions, "https://app.com", map[string]string{
+			"Access-Control-Request-Method":  http.MethodPost,
+			"Access-Control-Request-Headers": "content-type, accept",
+		})
+		assert.Equal(t, http.StatusNoContent, rw.Code)
+		assert.Equal(t, "https://app.com", rw.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "GET, POST", rw.Header().Get("Access-Control-Allow-Methods"))
+		assert.Equal(t, "Content-Type", rw.Header().Get("Access-Control-Allow-Headers"))
+		assert.Equal(t, "600", rw.Header().Get("Access-Control-Max-Age"))
+		assert.Equal(t, "Origin, Access-Control-Request-Method, Access-Control-Request-Headers", strings.Join(rw.Header()["Vary"], ", "))
+
+		rw = request(h, http.MethodOptions, "https://app.com", map[string]string{"Access-Control-Request-Method": http.MethodDelete})
+		assert.Equal(t, http.StatusMethodNotAllowed, rw.Code)
+
+		rw = request(h, http.MethodOptions, "https://app.com", map[string]string{
+			"Access-Control-Request-Method":  http.MethodPost,
+			"Access-Control-Request-Headers": "X-Secret",
+		})
+		assert.Equal(t, http.StatusForbidden, rw.Code)
+
+		rw = request(h, http.MethodOptions, "https://evil.com", map[string]string{"Access-Control-Request-Method": http.MethodGet})
+		assert.Equal(t, http.StatusForbidden, rw.Code)
+		assert.Equal(t, "", rw.Header().Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("Allows default methods", func(t *testing.T) {
+		o := options.Base{}
+		_, err := flags.NewParser(&o, flags.None).ParseArgs([]string{})
+		require.Nil(t, err)
+		assert.Equal(t, []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodOptions}, o.AllowedMethods)
+
+		o.AllowedOrigins = []string{"https://app.com"}
+		h := CORS(http.NotFoundHandler(), &o)
+		for _, method := range []string{http.MethodPost, http.MethodPut} {
+			rw := request(h, http.MethodOptions, "https://app.com", map[string]string{"Access-Control-Request-Method": method})
+			assert.Equal(t, http.StatusNoContent, rw.Code)
+		}
+
+		rw := request(h, http.MethodOptions, "https://app.com", map[string]string{"Access-Control-Request-Method": http.MethodDelete})
+		assert.Equal(t, http.StatusMethodNotAllowed, rw.Code)
+
+		// Simple methods are always allowed
+		o.AllowedMethods = []string{http.MethodPut}
+		h = CORS(http.NotFoundHandler(), &o)
+		rw = request(h, http.MethodOptions, "https://app.com", map[string]string{"Access-Control-Request-Method": http.MethodPost})
+		assert.Equal(t, http.StatusNoContent, rw.Code)
+	})
+}
@@ -1,33 +1,283 @@
 package security
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
 	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 
-	"github.com/ryankurte/go-csp"
+	log "github.com/sirupsen/logrus"
 
 	"github.com/ryankurte/go-api/lib/options"
 )
 
-// CSP builds a Content Security Policy (CSP) handler around the provided handler
-func CSP(h http.Handler, o *options.Base) http.Handler {
-	cspConfig := csp.CSP{
-		ReportOnly:  o.CSP.ReportOnly,
-		ChildSrc:    o.CSP.ChildSrc,
-		ConnectSrc:  o.CSP.ConnectSrc,
-		DefaultSrc:  o.CSP.DefaultSrc,
-		FontSrc:     o.CSP.FontSrc,
-		FrameSrc:    o.CSP.FrameSrc,
-		ImgSrc:      o.CSP.ImgSrc,
-		ManifestSrc: o.CSP.ManifestSrc,
-		MediaSrc:    o.CSP.MediaSrc,
-		ObjectSrc:   o.CSP.ObjectSrc,
-		ScriptSrc:   o.CSP.ScriptSrc,
-		StyleSrc:    o.CSP.StyleSrc,
-		WorkerSrc:   o.CSP.WorkerSrc,
-		ReportTo:    o.CSP.ReportTo,
-	}
-
-	// TODO: parse options to configure CSP
-
-	return cspConfig.Handler(h)
+// CSP source keywords
+const (
+	CSPStrictDynamic = "'strict-dynamic'"
+	cspNonceSize     = 16
+)
+
+// CSPReportEndpoint is the Reporting API endpoint name used for CSP violation reports,
+// declared via the Reporting-Endpoints header and referenced by the report-to directive
+const CSPReportEndpoint = "csp-endpoint"
+
+// CSPNonce is a per-request nonce for inline script and style elements.
+// This may be injected into typed handlers or fetched with GetCSPNonce for use in templates.
+type CSPNonce string
+
+// Source returns the CSP source expression for the nonce
+func (n CSPNonce) Source() string {
+	return "'nonce-" + string(n) + "'"
+}
+
+type cspNonceKey struct{}
+
+// NewCSPNonce generates a new random CSP nonce
+func NewCSPNonce() (CSPNonce, error) {
+	b := make([]byte, cspNonceSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return CSPNonce(base64.StdEncoding.EncodeToString(b)), nil
+}
+
+// WithCSPNonce attaches a CSP nonce to the provided context
+func WithCSPNonce(ctx context.Context, nonce CSPNonce) context.Context {
+	return context.WithValue(ctx, cspNonceKey{}, nonce)
+}
+
+// GetCSPNonce fetches the CSP nonce for a request.
+// This returns an empty nonce where nonces are not enabled.
+func GetCSPNonce(req *http.Request) CSPNonce {
+	nonce, _ := req.Context().Value(cspNonceKey{}).(CSPNonce)
+	return nonce
+}
+
+// CSPHash computes the CSP SHA256 source expression for inline content
+func CSPHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return "'sha256-" + base64.StdEncoding.EncodeToString(sum[:]) + "'"
+}
+
+var (
+	inlineScriptRegex = regexp.MustCompile(`(?is)<script([^>]*)>(.*?)</script>`)
+	inlineStyleRegex  = regexp.MustCompile(`(?is)<style([^>]*)>(.*?)</style>`)
+	srcAttributeRegex = regexp.MustCompile(`(?i)\ssrc\s*=`)
+)
+
+// HashInlineAssets computes CSP hashes for inline scripts and styles in HTML files under the provided directory
+func HashInlineAssets(dir string) (scripts, styles []string, err error) {
+	scripts, styles = make([]string, 0), make([]string, 0)
+
+	err = filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := strings.ToLower(filepath.Ext(p))
+		if info.IsDir() || (ext != ".html" && ext != ".htm") {
+			return nil
+		}
+
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range inlineScriptRegex.FindAllSubmatch(data, -1) {
+			if srcAttributeRegex.Match(m[1]) || len(m[2]) == 0 {
+				continue
+			}
+			scripts = appendUnique(scripts, CSPHash(m[2]))
+		}
+		for _, m := range inlineStyleRegex.FindAllSubmatch(data, -1) {
+			if len(m[2]) == 0 {
+				continue
+			}
+			styles = appendUnique(styles, CSPHash(m[2]))
+		}
+
+		return nil
+	})
+
+	return scripts, styles, err
+}
+
+func appendUnique(list []string, value string) []string {
+	for _, v := range list {
+		if v == value {
+			return list
+		}
+	}
+	return append(list, value)
+}
+
+// cspPolicy is a CSP policy with optional inline sources
+type cspPolicy struct {
+	o            *options.CSP
+	scriptHashes []string
+	styleHashes  []string
+}
+
+// inlineSources builds a source list including inline sources, falling back to default-src
+// where the directive is not otherwise specified so as not to restrict the configured sources.
+func (p *cspPolicy) inlineSources(sources []string, extra ...string) []string {
+	if len(extra) == 0 {
+		return sources
+	}
+	if len(sources) == 0 {
+		sources = p.o.DefaultSrc
+	}
+	return append(append([]string{}, sources...), extra...)
+}
+
+// String builds the policy header value with the provided nonce (if set)
+func (p *cspPolicy) String(nonce CSPNonce) string {
+	scriptExtra := append([]string{}, p.scriptHashes...)
+	styleExtra := append([]string{}, p.styleHashes...)
+	if nonce != "" {
+		scriptExtra = append(scriptExtra, nonce.Source())
+		styleExtra = append(styleExtra, nonce.Source())
+	}
+	if p.o.StrictDynamic {
+		scriptExtra = append(scriptExtra, CSPStrictDynamic)
+	}
+
+	directives := []struct {
+		name    string
+		sources []string
+	}{
+		{"default-src", p.o.DefaultSrc},
+		{"script-src", p.inlineSources(p.o.ScriptSrc, scriptExtra...)},
+		{"style-src", p.inlineSources(p.o.StyleSrc, styleExtra...)},
+		{"img-src", p.o.ImgSrc},
+		{"font-src", p.o.FontSrc},
+		{"child-src", p.o.ChildSrc},
+		{"connect-src", p.o.ConnectSrc},
+		{"frame-src", p.o.FrameSrc},
+		{"manifest-src", p.o.ManifestSrc},
+		{"media-src", p.o.MediaSrc},
+		{"object-src", p.o.ObjectSrc},
+		{"worker-src", p.o.WorkerSrc},
+	}
+
+	parts := make([]string, 0)
+	for _, d := range directives {
+		if len(d.sources) > 0 {
+			parts = append(parts, d.name+" "+strings.Join(d.sources, " "))
+		}
+	}
+	// Legacy report-uri is ignored by browsers supporting the Reporting API report-to directive
+	if p.o.ReportTo != "" {
+		parts = append(parts, "report-uri "+p.o.ReportTo, "report-to "+CSPReportEndpoint)
+	}
+
+	return strings.Join(parts, "; ")
+}
+
+// CSPBuilder builds CSP handlers for the default options and any policy overrides (see PolicyHandler),
+// sharing inline asset hashes and the violation report receiver (including rate limiting and de-duplication state)
+// between the handlers so these are computed once and limits apply across all routes.
+type CSPBuilder struct {
+	logger       log.FieldLogger
+	scriptHashes []string
+	styleHashes  []string
+	reportTo     string
+	reports      http.Handler
+}
+
+// NewCSPBuilder creates a CSP builder for the provided options.
+// Where enabled, hashes of inline scripts and styles in the static directory are computed for inclusion in policies.
+// Where the report address is a local path, violation reports are received at that path
+// and forwarded to the provided sinks (or logged if no sinks are provided).
+func NewCSPBuilder(o *options.Base, sinks ...CSPReportSink) *CSPBuilder {
+	b := CSPBuilder{logger: o.GetLogger().WithField("module", "csp")}
+	if o.NoCSP {
+		return &b
+	}
+
+	if o.CSP.HashStatic && o.StaticDir != "" {
+		scripts, styles, err := HashInlineAssets(o.StaticDir)
+		if err != nil {
+			b.logger.Errorf("Error hashing inline assets (%s)", err)
+		}
+		b.scriptHashes, b.styleHashes = scripts, styles
+	}
+
+	if strings.HasPrefix(o.CSP.ReportTo, "/") {
+		if len(sinks) == 0 {
+			sinks = []CSPReportSink{NewCSPLogSink(b.logger)}
+		}
+		b.reportTo = o.CSP.ReportTo
+		b.reports = NewCSPReportHandler(o.CSP.ReportRate, o.CSP.ReportDedupe, sinks...)
+	}
+
+	return &b
+}
+
+// CSP builds a Content Security Policy (CSP) handler around the provided handler.
+// Where enabled, a nonce is generated for each request and attached to the request context,
+// and hashes of inline scripts and styles in the static directory are added to the policy.
+// Where the report address is a local path, violation reports are received at that path
+// and forwarded to the provided sinks (or logged if no sinks are provided).
+func CSP(h http.Handler, o *options.Base, sinks ...CSPReportSink) http.Handler {
+	return NewCSPBuilder(o, sinks...).Build(h, o)
+}
+
+// Build builds a CSP handler around the provided handler using the provided (ie. overridden) options
+func (b *CSPBuilder) Build(h http.Handler, o *options.Base) http.Handler {
+	if o.NoCSP {
+		return h
+	}
+
+	logger := b.logger
+	policy := cspPolicy{o: &o.CSP, scriptHashes: b.scriptHashes, styleHashes: b.styleHashes}
+
+	headerName := "Content-Security-Policy"
+	if o.CSP.ReportOnly {
+		headerName = "Content-Security-Policy-Report-Only"
+	}
+	header := policy.String("")
+	endpoints := ""
+	if o.CSP.ReportTo != "" {
+		endpoints = fmt.Sprintf(`%s="%s"`, CSPReportEndpoint, o.CSP.ReportTo)
+	}
+
+	if b.reports != nil {
+		next := h
+		h = http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.URL.Path == b.reportTo {
+				b.reports.ServeHTTP(rw, req)
+				return
+			}
+			next.ServeHTTP(rw, req)
+		})
+	}
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if endpoints != "" {
+			rw.Header().Set("Reporting-Endpoints", endpoints)
+		}
+		if !o.CSP.Nonce {
+			rw.Header().Set(headerName, header)
+			h.ServeHTTP(rw, req)
+			return
+		}
+
+		nonce, err := NewCSPNonce()
+		if err != nil {
+			logger.Errorf("Error generating CSP nonce (%s)", err)
+			http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		rw.Header().Set(headerName, policy.String(nonce))
+		h.ServeHTTP(rw, req.WithContext(WithCSPNonce(req.Context(), nonce)))
+	})
 }
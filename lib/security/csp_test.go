@@ -0,0 +1,98 @@
+package security
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ryankurte/go-api/lib/options"
+)
+
+const inlineHTML = `<html><head>
+<style>body { color: red; }</style>
+<script src="/app.js"></script>
+<script>console.log("hello");</script>
+</head></html>`
+
+func TestCSP(t *testing.T) {
+	var nonce CSPNonce
+	h := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		nonce = GetCSPNonce(req)
+	})
+
+	get := func(h http.Handler) *httptest.ResponseRecorder {
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rw
+	}
+
+	t.Run("Builds static policies", func(t *testing.T) {
+		o := options.Base{}
+		o.CSP.DefaultSrc = []string{"'self'"}
+		o.CSP.ImgSrc = []string{"'self'", "data:"}
+		o.CSP.ReportTo = "/csp-report"
+
+		rw := get(CSP(h, &o))
+		assert.Equal(t, "default-src 'self'; img-src 'self' data:; report-uri /csp-report; report-to csp-endpoint", rw.Header().Get("Content-Security-Policy"))
+		assert.Equal(t, `csp-endpoint="/csp-report"`, rw.Header().Get("Reporting-Endpoints"))
+		assert.Equal(t, CSPNonce(""), nonce)
+	})
+
+	t.Run("Sets report only header", func(t *testing.T) {
+		o := options.Base{}
+		o.CSP.DefaultSrc = []string{"'self'"}
+		o.CSP.ReportOnly = true
+
+		rw := get(CSP(h, &o))
+		assert.Equal(t, "default-src 'self'", rw.Header().Get("Content-Security-Policy-Report-Only"))
+	})
+
+	t.Run("Generates per-request nonces", func(t *testing.T) {
+		o := options.Base{}
+		o.CSP.DefaultSrc = []string{"'self'"}
+		o.CSP.Nonce = true
+		o.CSP.StrictDynamic = true
+
+		c := CSP(h, &o)
+
+		rw := get(c)
+		first := nonce
+		require.NotEqual(t, CSPNonce(""), first)
+		policy := rw.Header().Get("Content-Security-Policy")
+		assert.Contains(t, policy, "script-src 'self' "+first.Source()+" 'strict-dynamic'")
+		assert.Contains(t, policy, "style-src 'self' "+first.Source())
+
+		get(c)
+		assert.NotEqual(t, first, nonce)
+	})
+
+	t.Run("Hashes inline static assets", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "csp")
+		require.Nil(t, err)
+		defer os.RemoveAll(dir)
+		require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "index.html"), []byte(inlineHTML), 0644))
+
+		scripts, styles, err := HashInlineAssets(dir)
+		require.Nil(t, err)
+		assert.Equal(t, []string{CSPHash([]byte(`console.log("hello");`))}, scripts)
+		assert.Equal(t, []string{CSPHash([]byte(`body { color: red; }`))}, styles)
+
+		o := options.Base{}
+		o.StaticDir = dir
+		o.CSP.DefaultSrc = []string{"'self'"}
+		o.CSP.ScriptSrc = []string{"'self'", "https://cdn.example.com"}
+		o.CSP.HashStatic = true
+
+		policy := get(CSP(h, &o)).Header().Get("Content-Security-Policy")
+		assert.Contains(t, policy, "script-src 'self' https://cdn.example.com "+scripts[0])
+		assert.Contains(t, policy, "style-src 'self' "+styles[0])
+		assert.False(t, strings.Contains(policy, "unsafe-inline"))
+	})
+}
@@ -0,0 +1,292 @@
+package security
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// CSP report content types
+const (
+	CSPReportContentType      = "application/csp-report"
+	ReportingAPIContentType   = "application/reports+json"
+	reportingAPICSPViolation  = "csp-violation"
+	maxCSPReportSize          = 64 * 1024
+	maxCSPReportDedupeEntries = 10000
+)
+
+// CSPReport is a normalised Content Security Policy violation report
+type CSPReport struct {
+	DocumentURI        string `json:"documentURI"`
+	Referrer           string `json:"referrer,omitempty"`
+	BlockedURI         string `json:"blockedURI"`
+	ViolatedDirective  string `json:"violatedDirective,omitempty"`
+	EffectiveDirective string `json:"effectiveDirective"`
+	OriginalPolicy     string `json:"originalPolicy,omitempty"`
+	Disposition        string `json:"disposition,omitempty"`
+	StatusCode         int    `json:"statusCode,omitempty"`
+	SourceFile         string `json:"sourceFile,omitempty"`
+	LineNumber         int    `json:"lineNumber,omitempty"`
+	ColumnNumber       int    `json:"columnNumber,omitempty"`
+	Sample             string `json:"sample,omitempty"`
+	UserAgent          string `json:"userAgent,omitempty"`
+}
+
+// key identifies duplicate reports
+func (r *CSPReport) key() string {
+	return strings.Join([]string{r.DocumentURI, r.BlockedURI, r.EffectiveDirective, r.SourceFile, fmt.Sprint(r.LineNumber)}, "|")
+}
+
+// CSPReportSink receives CSP violation reports
+type CSPReportSink interface {
+	ReportCSP(r CSPReport)
+}
+
+// CSPReportSinkFunc adapts a function to a CSPReportSink
+type CSPReportSinkFunc func(r CSPReport)
+
+// ReportCSP calls the underlying function
+func (f CSPReportSinkFunc) ReportCSP(r CSPReport) {
+	f(r)
+}
+
+// CSPLogSink logs CSP violation reports
+type CSPLogSink struct {
+	logger log.FieldLogger
+}
+
+// NewCSPLogSink creates a sink logging CSP violation reports to the provided logger
+func NewCSPLogSink(logger log.FieldLogger) *CSPLogSink {
+	return &CSPLogSink{logger: logger}
+}
+
+// ReportCSP logs a CSP violation report
+func (s *CSPLogSink) ReportCSP(r CSPReport) {
+	s.logger.WithFields(log.Fields{
+		"document_uri":        r.DocumentURI,
+		"blocked_uri":         r.BlockedURI,
+		"effective_directive": r.EffectiveDirective,
+		"disposition":         r.Disposition,
+		"source_file":         r.SourceFile,
+		"line_number":         r.LineNumber,
+		"user_agent":          r.UserAgent,
+	}).Warn("CSP violation")
+}
+
+// legacyCSPReport is the report-uri report format
+type legacyCSPReport struct {
+	Report struct {
+		DocumentURI        string `json:"document-uri"`
+		Referrer           string `json:"referrer"`
+		BlockedURI         string `json:"blocked-uri"`
+		ViolatedDirective  string `json:"violated-directive"`
+		EffectiveDirective string `json:"effective-directive"`
+		OriginalPolicy     string `json:"original-policy"`
+		Disposition        string `json:"disposition"`
+		StatusCode         int    `json:"status-code"`
+		SourceFile         string `json:"source-file"`
+		LineNumber         int    `json:"line-number"`
+		ColumnNumber       int    `json:"column-number"`
+		ScriptSample       string `json:"script-sample"`
+	} `json:"csp-report"`
+}
+
+// reportingAPIReport is the Reporting API (report-to) report format
+type reportingAPIReport struct {
+	Type      string `json:"type"`
+	URL       string `json:"url"`
+	UserAgent string `json:"user_agent"`
+	Body      struct {
+		DocumentURL        string `json:"documentURL"`
+		Referrer           string `json:"referrer"`
+		BlockedURL         string `json:"blockedURL"`
+		EffectiveDirective string `json:"effectiveDirective"`
+		OriginalPolicy     string `json:"originalPolicy"`
+		Disposition        string `json:"disposition"`
+		StatusCode         int    `json:"statusCode"`
+		SourceFile         string `json:"sourceFile"`
+		LineNumber         int    `json:"lineNumber"`
+		ColumnNumber       int    `json:"columnNumber"`
+		Sample             string `json:"sample"`
+	} `json:"body"`
+}
+
+// ParseCSPReports parses CSP violation reports in legacy report-uri or Reporting API formats
+func ParseCSPReports(contentType string, data []byte) ([]CSPReport, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	switch mediaType {
+	case CSPReportContentType:
+		l := legacyCSPReport{}
+		if err := json.Unmarshal(data, &l); err != nil {
+			return nil, err
+		}
+		effective := l.Report.EffectiveDirective
+		if effective == "" {
+			effective = l.Report.ViolatedDirective
+		}
+		return []CSPReport{{
+			DocumentURI:        l.Report.DocumentURI,
+			Referrer:           l.Report.Referrer,
+			BlockedURI:         l.Report.BlockedURI,
+			ViolatedDirective:  l.Report.ViolatedDirective,
+			EffectiveDirective: effective,
+			OriginalPolicy:     l.Report.OriginalPolicy,
+			Disposition:        l.Report.Disposition,
+			StatusCode:         l.Report.StatusCode,
+			SourceFile:         l.Report.SourceFile,
+			LineNumber:         l.Report.LineNumber,
+			ColumnNumber:       l.Report.ColumnNumber,
+			Sample:             l.Report.ScriptSample,
+		}}, nil
+
+	case ReportingAPIContentType:
+		reports := make([]reportingAPIReport, 0)
+		if err := json.Unmarshal(data, &reports); err != nil {
+			return nil, err
+		}
+		parsed := make([]CSPReport, 0)
+		for _, r := range reports {
+			if r.Type != reportingAPICSPViolation {
+				continue
+			}
+			documentURL := r.Body.DocumentURL
+			if documentURL == "" {
+				documentURL = r.URL
+			}
+			parsed = append(parsed, CSPReport{
+				DocumentURI:        documentURL,
+				Referrer:           r.Body.Referrer,
+				BlockedURI:         r.Body.BlockedURL,
+				EffectiveDirective: r.Body.EffectiveDirective,
+				OriginalPolicy:     r.Body.OriginalPolicy,
+				Disposition:        r.Body.Disposition,
+				StatusCode:         r.Body.StatusCode,
+				SourceFile:         r.Body.SourceFile,
+				LineNumber:         r.Body.LineNumber,
+				ColumnNumber:       r.Body.ColumnNumber,
+				Sample:             r.Body.Sample,
+				UserAgent:          r.UserAgent,
+			})
+		}
+		return parsed, nil
+
+	default:
+		return nil, fmt.Errorf("Unsupported CSP report content type '%s'", contentType)
+	}
+}
+
+// CSPReportHandler receives CSP violation reports, forwarding them to the provided sinks.
+// Reports are rate limited to the provided rate per second (0 for unlimited),
+// and duplicate reports within the dedupe window are dropped.
+type CSPReportHandler struct {
+	sinks  []CSPReportSink
+	rate   float64
+	dedupe time.Duration
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+	seen   map[string]time.Time
+}
+
+// NewCSPReportHandler creates a CSP report handler
+func NewCSPReportHandler(rate float64, dedupe time.Duration, sinks ...CSPReportSink) *CSPReportHandler {
+	return &CSPReportHandler{
+		sinks:  sinks,
+		rate:   rate,
+		dedupe: dedupe,
+		tokens: math.Max(rate, 1),
+		last:   time.Now(),
+		seen:   make(map[string]time.Time),
+	}
+}
+
+func (h *CSPReportHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(rw, "CSP reports must be submitted via POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := ioutil.ReadAll(http.MaxBytesReader(rw, req.Body, maxCSPReportSize))
+	if err != nil {
+		http.Error(rw, "Invalid CSP report", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	reports, err := ParseCSPReports(req.Header.Get("Content-Type"), data)
+	if err != nil {
+		http.Error(rw, fmt.Sprintf("Invalid CSP report (%s)", err), http.StatusBadRequest)
+		return
+	}
+
+	for _, r := range reports {
+		if r.UserAgent == "" {
+			r.UserAgent = req.UserAgent()
+		}
+		if !h.accept(&r) {
+			continue
+		}
+		for _, s := range h.sinks {
+			s.ReportCSP(r)
+		}
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// accept applies rate limiting and deduplication to a report
+func (h *CSPReportHandler) accept(r *CSPReport) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+
+	// Drop duplicates within the dedupe window
+	key := r.key()
+	if h.dedupe > 0 {
+		if t, ok := h.seen[key]; ok && now.Sub(t) < h.dedupe {
+			return false
+		}
+	}
+
+	// Token bucket rate limiting, with a burst of one second of reports
+	if h.rate > 0 {
+		h.tokens = math.Min(h.tokens+now.Sub(h.last).Seconds()*h.rate, math.Max(h.rate, 1))
+		h.last = now
+		if h.tokens < 1 {
+			return false
+		}
+		h.tokens--
+	}
+
+	// Record only forwarded reports, so reports dropped by the rate limiter may be delivered later
+	if h.dedupe > 0 {
+		if len(h.seen) >= maxCSPReportDedupeEntries {
+			h.prune(now)
+		}
+		h.seen[key] = now
+	}
+
+	return true
+}
+
+// prune removes expired dedupe entries, resetting if the limit is still exceeded
+func (h *CSPReportHandler) prune(now time.Time) {
+	for k, t := range h.seen {
+		if now.Sub(t) >= h.dedupe {
+			delete(h.seen, k)
+		}
+	}
+	if len(h.seen) >= maxCSPReportDedupeEntries {
+		h.seen = make(map[string]time.Time)
+	}
+}
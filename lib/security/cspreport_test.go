@@ -0,0 +1,161 @@
+package security
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ryankurte/go-api/lib/options"
+)
+
+const legacyReport = `{"csp-report": {
+	"document-uri": "https://example.com/page",
+	"referrer": "",
+	"blocked-uri": "https://evil.com/script.js",
+	"violated-directive": "script-src-elem",
+	"effective-directive": "script-src-elem",
+	"original-policy": "default-src 'self'; report-uri /csp-report",
+	"disposition": "enforce",
+	"status-code": 200,
+	"source-file": "https://example.com/page",
+	"line-number": 10,
+	"column-number": 4
+}}`
+
+const reportingAPIBody = `[{
+	"type": "csp-violation",
+	"age": 10,
+	"url": "https://example.com/page",
+	"user_agent": "test-agent",
+	"body": {
+		"documentURL": "https://example.com/page",
+		"blockedURL": "inline",
+		"effectiveDirective": "style-src-attr",
+		"originalPolicy": "default-src 'self'",
+		"disposition": "report",
+		"statusCode": 200,
+		"lineNumber": 3
+	}
+}, {
+	"type": "deprecation",
+	"url": "https://example.com/page",
+	"body": {}
+}]`
+
+func postReport(h http.Handler, contentType, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/csp-report", bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", contentType)
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, req)
+	return rw
+}
+
+func TestCSPReports(t *testing.T) {
+
+	t.Run("Parses legacy reports", func(t *testing.T) {
+		reports, err := ParseCSPReports(CSPReportContentType, []byte(legacyReport))
+		require.Nil(t, err)
+		require.Len(t, reports, 1)
+		assert.Equal(t, "https://evil.com/script.js", reports[0].BlockedURI)
+		assert.Equal(t, "script-src-elem", reports[0].EffectiveDirective)
+		assert.Equal(t, 10, reports[0].LineNumber)
+	})
+
+	t.Run("Parses Reporting API reports", func(t *testing.T) {
+		reports, err := ParseCSPReports(ReportingAPIContentType, []byte(reportingAPIBody))
+		require.Nil(t, err)
+		require.Len(t, reports, 1)
+		assert.Equal(t, "inline", reports[0].BlockedURI)
+		assert.Equal(t, "style-src-attr", reports[0].EffectiveDirective)
+		assert.Equal(t, "report", reports[0].Disposition)
+		assert.Equal(t, "test-agent", reports[0].UserAgent)
+	})
+
+	t.Run("Rejects unsupported content types", func(t *testing.T) {
+		_, err := ParseCSPReports("application/json", []byte(legacyReport))
+		assert.NotNil(t, err)
+	})
+
+	t.Run("Forwards reports to sinks", func(t *testing.T) {
+		received := make([]CSPReport, 0)
+		h := NewCSPReportHandler(0, 0, CSPReportSinkFunc(func(r CSPReport) {
+			received = append(received, r)
+		}))
+
+		assert.Equal(t, http.StatusNoContent, postReport(h, CSPReportContentType, legacyReport).Code)
+		assert.Equal(t, http.StatusNoContent, postReport(h, ReportingAPIContentType, reportingAPIBody).Code)
+		assert.Equal(t, http.StatusBadRequest, postReport(h, CSPReportContentType, "{").Code)
+		assert.Len(t, received, 2)
+	})
+
+	t.Run("Drops duplicate reports", func(t *testing.T) {
+		count := 0
+		h := NewCSPReportHandler(0, time.Minute, CSPReportSinkFunc(func(r CSPReport) { count++ }))
+
+		postReport(h, CSPReportContentType, legacyReport)
+		postReport(h, CSPReportContentType, legacyReport)
+		postReport(h, ReportingAPIContentType, reportingAPIBody)
+		assert.Equal(t, 2, count)
+	})
+
+	t.Run("Rate limits reports", func(t *testing.T) {
+		count := 0
+		h := NewCSPReportHandler(2, 0, CSPReportSinkFunc(func(r CSPReport) { count++ }))
+
+		for i := 0; i < 10; i++ {
+			postReport(h, CSPReportContentType, legacyReport)
+		}
+		assert.Equal(t, 2, count)
+	})
+
+	t.Run("Delivers reports previously dropped by the rate limiter", func(t *testing.T) {
+		count := 0
+		h := NewCSPReportHandler(1, time.Minute, CSPReportSinkFunc(func(r CSPReport) { count++ }))
+
+		postReport(h, CSPReportContentType, legacyReport)
+		postReport(h, ReportingAPIContentType, reportingAPIBody)
+		assert.Equal(t, 1, count)
+
+		// Refill the token bucket
+		h.mu.Lock()
+		h.last = h.last.Add(-time.Second)
+		h.mu.Unlock()
+
+		postReport(h, ReportingAPIContentType, reportingAPIBody)
+		assert.Equal(t, 2, count)
+	})
+
+	t.Run("Receives reports at the CSP report address", func(t *testing.T) {
+		count := 0
+		o := options.Base{}
+		o.CSP.ReportTo = "/csp-report"
+
+		h := CSP(http.NotFoundHandler(), &o, CSPReportSinkFunc(func(r CSPReport) { count++ }))
+
+		rw := postReport(h, CSPReportContentType, legacyReport)
+		assert.Equal(t, http.StatusNoContent, rw.Code)
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("Shares report limits between policies", func(t *testing.T) {
+		count := 0
+		o := options.Base{}
+		o.CSP.ReportTo = "/csp-report"
+		o.CSP.ReportRate = 2
+
+		b := NewCSPBuilder(&o, CSPReportSinkFunc(func(r CSPReport) { count++ }))
+		override := o
+		override.CSP.ReportOnly = true
+		handlers := []http.Handler{b.Build(http.NotFoundHandler(), &o), b.Build(http.NotFoundHandler(), &override)}
+
+		for i := 0; i < 10; i++ {
+			postReport(handlers[i%2], CSPReportContentType, legacyReport)
+		}
+		assert.Equal(t, 2, count)
+	})
+}
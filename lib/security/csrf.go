@@ -0,0 +1,293 @@
+package security
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/sessions"
+
+	"github.com/ryankurte/go-api/lib/options"
+)
+
+const (
+	csrfSecretSize = 32
+	csrfSecretKey  = "secret"
+)
+
+// CSRFToken is a per-request masked CSRF token, to be returned in the CSRF header or form field
+// with unsafe requests. This may be injected into typed handlers or fetched with GetCSRFToken for use in templates.
+type CSRFToken string
+
+type csrfKey struct{}
+
+type csrfExemptKey struct{}
+
+// IsCSRFExempt checks whether a request is to a route exempted from CSRF protection (see CSRFExempt),
+// in which case requests must not be authenticated using cookies.
+func IsCSRFExempt(req *http.Request) bool {
+	exempt, _ := req.Context().Value(csrfExemptKey{}).(bool)
+	return exempt
+}
+
+// csrfState lazily creates the session CSRF secret, so sessions are only created where tokens are used
+type csrfState struct {
+	rw    http.ResponseWriter
+	req   *http.Request
+	store sessions.Store
+	name  string
+}
+
+// secret fetches the CSRF secret bound to the session, creating the secret (and session) if required
+func (s *csrfState) secret(create bool) ([]byte, error) {
+	session, err := s.store.Get(s.req, s.name)
+	if err != nil && !create {
+		return nil, err
+	}
+	if secret, ok := session.Values[csrfSecretKey].([]byte); ok && len(secret) == csrfSecretSize {
+		return secret, nil
+	}
+	if !create {
+		return nil, fmt.Errorf("No CSRF secret in session")
+	}
+
+	return s.generate(session, s.rw)
+}
+
+// generate creates a new CSRF secret, storing it in the session
+func (s *csrfState) generate(session *sessions.Session, rw http.ResponseWriter) ([]byte, error) {
+	secret := make([]byte, csrfSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	session.Values[csrfSecretKey] = secret
+	if err := session.Save(s.req, rw); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// GetCSRFToken fetches a CSRF token for a request, creating the session CSRF secret if required.
+// As this may set a session cookie, this must be called prior to writing the response.
+// This returns an empty token where CSRF protection is not enabled.
+func GetCSRFToken(req *http.Request) (CSRFToken, error) {
+	s, ok := req.Context().Value(csrfKey{}).(*csrfState)
+	if !ok {
+		return "", nil
+	}
+	secret, err := s.secret(true)
+	if err != nil {
+		return "", fmt.Errorf("Error fetching CSRF secret (%s)", err)
+	}
+	return maskCSRFToken(secret)
+}
+
+// RotateCSRFSecret replaces the session CSRF secret where one exists, invalidating previously issued tokens.
+// This should be called when the authenticated principal changes (ie. on login, see auth.Session and session.Control),
+// so tokens obtained prior to authentication may not be used. New tokens may be fetched with GetCSRFToken.
+// This does nothing where CSRF protection is not enabled.
+func RotateCSRFSecret(rw http.ResponseWriter, req *http.Request) error {
+	s, ok := req.Context().Value(csrfKey{}).(*csrfState)
+	if !ok {
+		return nil
+	}
+	session, err := s.store.Get(s.req, s.name)
+	if err != nil {
+		return nil
+	}
+	if _, ok := session.Values[csrfSecretKey]; !ok {
+		return nil
+	}
+	if _, err := s.generate(session, rw); err != nil {
+		return fmt.Errorf("Error rotating CSRF secret (%s)", err)
+	}
+	return nil
+}
+
+// maskCSRFToken masks the secret with a one-time pad, so tokens differ between responses (mitigating BREACH)
+func maskCSRFToken(secret []byte) (CSRFToken, error) {
+	token := make([]byte, 2*len(secret))
+	if _, err := rand.Read(token[:len(secret)]); err != nil {
+		return "", err
+	}
+	for i := range secret {
+		token[len(secret)+i] = token[i] ^ secret[i]
+	}
+	return CSRFToken(base64.RawURLEncoding.EncodeToString(token)), nil
+}
+
+// unmaskCSRFToken recovers the secret from a masked token
+func unmaskCSRFToken(token string) []byte {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(data) != 2*csrfSecretSize {
+		return nil
+	}
+	secret := make([]byte, csrfSecretSize)
+	for i := range secret {
+		secret[i] = data[i] ^ data[csrfSecretSize+i]
+	}
+	return secret
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	default:
+		return false
+	}
+}
+
+// defaultMaxFormSize limits form bodies read for CSRF tokens where no body limit is configured,
+// matching the limit applied by http.Request.ParseForm
+const defaultMaxFormSize = 10 << 20
+
+// formToken reads the CSRF token from a form body, limiting the body to the provided size.
+// The body is then replaced with the remaining fields (removing the token so it is not decoded as an input field),
+// so the form is parsed by the endpoint decoder subject to the endpoint body size limit.
+func formToken(rw http.ResponseWriter, req *http.Request, field string, limit int64) (string, error) {
+	if req.Body == nil {
+		return "", nil
+	}
+	if limit <= 0 {
+		limit = defaultMaxFormSize
+	}
+
+	data, err := ioutil.ReadAll(http.MaxBytesReader(rw, req.Body, limit))
+	req.Body.Close()
+	if err != nil {
+		req.Body = http.NoBody
+		return "", err
+	}
+
+	values, err := url.ParseQuery(string(data))
+	if err != nil {
+		req.Body = ioutil.NopCloser(bytes.NewReader(data))
+		return "", nil
+	}
+	token := values.Get(field)
+	values.Del(field)
+
+	body := values.Encode()
+	req.Body = ioutil.NopCloser(strings.NewReader(body))
+	req.ContentLength = int64(len(body))
+	return token, nil
+}
+
+// requestOrigin builds the origin (scheme and host) a request was received on.
+// Where TLS is terminated by a proxy, the external address should be set so it is trusted.
+func requestOrigin(req *http.Request) string {
+	if req.TLS != nil {
+		return "https://" + req.Host
+	}
+	return "http://" + req.Host
+}
+
+// hasCookie checks whether the request carries any of the named cookies
+func hasCookie(req *http.Request, names []string) bool {
+	for _, n := range names {
+		if _, err := req.Cookie(n); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// CSRF builds a Cross Site Request Forgery (CSRF) protection handler around the provided handler.
+// Unsafe requests carrying session cookies (and so potentially cookie authenticated) must include a token bound
+// to the session (see GetCSRFToken) in the CSRF header or form field, and where Origin or Referer headers
+// are provided these must match the request origin (scheme and host), external address or trusted origins.
+// Session cookies are the CSRF session cookie, the provided cookies and those configured in the options,
+// so any cookie used to authenticate requests MUST be listed. Requests without session cookies
+// (ie. API key or token authenticated clients, which may carry unrelated cookies) are not checked,
+// and routes may be exempted using CSRFExempt.
+func CSRF(h http.Handler, o *options.Base, store sessions.Store, cookies ...string) http.Handler {
+	if o.NoCSRF {
+		return h
+	}
+	if o.Exempt {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			h.ServeHTTP(rw, req.WithContext(context.WithValue(req.Context(), csrfExemptKey{}, true)))
+		})
+	}
+
+	logger := o.GetLogger().WithField("module", "csrf")
+
+	trusted, err := newOriginMatcher(append([]string{o.GetExternalAddress()}, o.TrustedOrigins...), nil)
+	if err != nil {
+		logger.Errorf("Error parsing CSRF trusted origins (%s)", err)
+		trusted = &originMatcher{exact: []string{o.GetExternalAddress()}}
+	}
+
+	sessionCookies := append(append([]string{o.SessionName}, o.SessionCookies...), cookies...)
+
+	reject := func(rw http.ResponseWriter, req *http.Request, reason string) {
+		logger.WithField("path", req.URL.Path).Warnf("CSRF check failed (%s)", reason)
+		http.Error(rw, "Forbidden - CSRF check failed", http.StatusForbidden)
+	}
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		s := &csrfState{rw: rw, store: store, name: o.SessionName}
+		req = req.WithContext(context.WithValue(req.Context(), csrfKey{}, s))
+		s.req = req
+
+		if isSafeMethod(req.Method) || !hasCookie(req, sessionCookies) {
+			h.ServeHTTP(rw, req)
+			return
+		}
+
+		// Check request source where provided
+		source := req.Header.Get("Origin")
+		if source == "" {
+			source = req.Header.Get("Referer")
+		}
+		if source != "" {
+			u, err := url.Parse(source)
+			if err != nil || u.Host == "" {
+				reject(rw, req, "invalid origin")
+				return
+			}
+			origin := u.Scheme + "://" + u.Host
+			if !strings.EqualFold(origin, requestOrigin(req)) && !trusted.Match(req, origin) {
+				reject(rw, req, fmt.Sprintf("untrusted origin '%s'", origin))
+				return
+			}
+		}
+
+		// Check the provided token against the session secret
+		token := req.Header.Get(o.HeaderName)
+		if token == "" {
+			if mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type")); mediaType == "application/x-www-form-urlencoded" {
+				t, err := formToken(rw, req, o.FieldName, o.MaxBodySize)
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					http.Error(rw, fmt.Sprintf("Request body exceeds %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+					return
+				}
+				token = t
+			}
+		}
+
+		secret, err := s.secret(false)
+		if err != nil {
+			reject(rw, req, "no session secret")
+			return
+		}
+		provided := unmaskCSRFToken(token)
+		if provided == nil || subtle.ConstantTimeCompare(provided, secret) != 1 {
+			reject(rw, req, "invalid token")
+			return
+		}
+
+		h.ServeHTTP(rw, req)
+	})
+}
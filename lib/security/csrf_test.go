@@ -0,0 +1,161 @@
+package security
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/sessions"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ryankurte/go-api/lib/options"
+)
+
+func TestCSRF(t *testing.T) {
+	o := options.Base{}
+	o.ExternalAddress = "api.example.com"
+	o.SessionName = "_csrf"
+	o.HeaderName = "X-CSRF-Token"
+	o.FieldName = "csrf_token"
+	o.TrustedOrigins = []string{"https://*.example.com"}
+
+	store := sessions.NewCookieStore([]byte("csrf-test-secret"))
+
+	var form url.Values
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/login" {
+			require.Nil(t, RotateCSRFSecret(rw, req))
+		}
+		token, err := GetCSRFToken(req)
+		require.Nil(t, err)
+		req.ParseForm()
+		rw.Write([]byte(token))
+		form = req.PostForm
+	})
+	h := CSRF(next, &o, store, "auth")
+
+	// Fetch a token and session cookie
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "https://api.example.com/", nil))
+	token := rw.Body.String()
+	cookies := rw.Result().Cookies()
+	require.NotEqual(t, "", token)
+	require.Len(t, cookies, 1)
+
+	request := func(body string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "https://api.example.com/", strings.NewReader(body))
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, req)
+		return rw
+	}
+
+	t.Run("Masks tokens per request", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "https://api.example.com/", nil)
+		req.AddCookie(cookies[0])
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, req)
+		assert.NotEqual(t, token, rw.Body.String())
+		assert.Len(t, rw.Result().Cookies(), 0)
+	})
+
+	t.Run("Accepts tokens in header", func(t *testing.T) {
+		rw := request("", map[string]string{"X-CSRF-Token": token, "Origin": "https://api.example.com"})
+		assert.Equal(t, http.StatusOK, rw.Code)
+	})
+
+	t.Run("Accepts tokens in form fields", func(t *testing.T) {
+		rw := request("name=test&csrf_token="+token, map[string]string{"Content-Type": "application/x-www-form-urlencoded"})
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, url.Values{"name": []string{"test"}}, form)
+	})
+
+	t.Run("Accepts trusted origins", func(t *testing.T) {
+		rw := request("", map[string]string{"X-CSRF-Token": token, "Referer": "https://app.example.com/page"})
+		assert.Equal(t, http.StatusOK, rw.Code)
+	})
+
+	t.Run("Rejects missing or invalid tokens", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, request("", nil).Code)
+		assert.Equal(t, http.StatusForbidden, request("", map[string]string{"X-CSRF-Token": "invalid"}).Code)
+
+		other, err := maskCSRFToken(make([]byte, csrfSecretSize))
+		require.Nil(t, err)
+		assert.Equal(t, http.StatusForbidden, request("", map[string]string{"X-CSRF-Token": string(other)}).Code)
+	})
+
+	t.Run("Rejects untrusted origins", func(t *testing.T) {
+		rw := request("", map[string]string{"X-CSRF-Token": token, "Origin": "https://evil.com"})
+		assert.Equal(t, http.StatusForbidden, rw.Code)
+
+		rw = request("", map[string]string{"X-CSRF-Token": token, "Origin": "null"})
+		assert.Equal(t, http.StatusForbidden, rw.Code)
+
+		// Same host with a different scheme
+		rw = request("", map[string]string{"X-CSRF-Token": token, "Origin": "http://api.example.com"})
+		assert.Equal(t, http.StatusForbidden, rw.Code)
+	})
+
+	t.Run("Does not check requests without cookies", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "https://api.example.com/", nil))
+		assert.Equal(t, http.StatusOK, rw.Code)
+	})
+
+	t.Run("Checks requests carrying session cookies only", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "https://api.example.com/", nil)
+		req.AddCookie(&http.Cookie{Name: "AWSALB", Value: "affinity"})
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, req)
+		assert.Equal(t, http.StatusOK, rw.Code)
+
+		req = httptest.NewRequest(http.MethodPost, "https://api.example.com/", nil)
+		req.AddCookie(&http.Cookie{Name: "auth", Value: "session"})
+		rw = httptest.NewRecorder()
+		h.ServeHTTP(rw, req)
+		assert.Equal(t, http.StatusForbidden, rw.Code)
+	})
+
+	t.Run("Limits form bodies before parsing", func(t *testing.T) {
+		limited := o
+		limited.MaxBodySize = 64
+		h := CSRF(next, &limited, store)
+
+		req := httptest.NewRequest(http.MethodPost, "https://api.example.com/", strings.NewReader("name="+strings.Repeat("a", 64)+"&csrf_token="+token))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(cookies[0])
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, req)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rw.Code)
+	})
+
+	t.Run("Rotates secrets", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "https://api.example.com/login", nil)
+		req.AddCookie(cookies[0])
+		req.Header.Set("X-CSRF-Token", token)
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, req)
+		require.Equal(t, http.StatusOK, rw.Code)
+		rotated := rw.Result().Cookies()
+		require.Len(t, rotated, 1)
+
+		post := func(token string) int {
+			req := httptest.NewRequest(http.MethodPost, "https://api.example.com/", nil)
+			req.AddCookie(rotated[0])
+			req.Header.Set("X-CSRF-Token", token)
+			rw := httptest.NewRecorder()
+			h.ServeHTTP(rw, req)
+			return rw.Code
+		}
+		assert.Equal(t, http.StatusForbidden, post(token))
+		assert.Equal(t, http.StatusOK, post(rw.Body.String()))
+	})
+}
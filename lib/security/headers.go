@@ -0,0 +1,52 @@
+package security
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/ryankurte/go-api/lib/options"
+)
+
+// Headers builds a handler setting security headers around the provided handler,
+// including HSTS (see HSTS), X-Content-Type-Options, Referrer-Policy, Permissions-Policy,
+// cross origin isolation headers and X-Frame-Options as configured.
+// Headers are set prior to calling the handler so may be overridden by endpoints.
+func Headers(h http.Handler, o *options.Base) http.Handler {
+	headers := make(http.Header)
+
+	if !o.NoContentTypeOptions {
+		headers.Set("X-Content-Type-Options", "nosniff")
+	}
+	if !o.NoReferrerPolicy && o.Referrer != "" {
+		headers.Set("Referrer-Policy", o.Referrer)
+	}
+	if !o.NoPermissionsPolicy && len(o.Permissions) > 0 {
+		headers.Set("Permissions-Policy", strings.Join(o.Permissions, ", "))
+	}
+	if !o.NoCrossOrigin {
+		if o.OpenerPolicy != "" {
+			headers.Set("Cross-Origin-Opener-Policy", o.OpenerPolicy)
+		}
+		if o.EmbedderPolicy != "" {
+			headers.Set("Cross-Origin-Embedder-Policy", o.EmbedderPolicy)
+		}
+		if o.ResourcePolicy != "" {
+			headers.Set("Cross-Origin-Resource-Policy", o.ResourcePolicy)
+		}
+	}
+	if !o.NoFrameOptions && o.Frame != "" {
+		headers.Set("X-Frame-Options", o.Frame)
+	}
+
+	h = HSTS(h, o)
+	if len(headers) == 0 {
+		return h
+	}
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		for k := range headers {
+			rw.Header().Set(k, headers.Get(k))
+		}
+		h.ServeHTTP(rw, req)
+	})
+}
@@ -0,0 +1,71 @@
+package security
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ryankurte/go-api/lib/options"
+)
+
+func TestHeaders(t *testing.T) {
+	ok := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {})
+
+	newOptions := func() *options.Base {
+		o := options.Base{}
+		o.HSTS.MaxAge = time.Hour
+		o.Referrer = "strict-origin-when-cross-origin"
+		o.Permissions = []string{"camera=()", "geolocation=(self)"}
+		o.OpenerPolicy = "same-origin"
+		o.ResourcePolicy = "same-origin"
+		o.Frame = "DENY"
+		return &o
+	}
+
+	get := func(h http.Handler) http.Header {
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rw.Header()
+	}
+
+	t.Run("Sets security headers", func(t *testing.T) {
+		headers := get(Headers(ok, newOptions()))
+
+		assert.Equal(t, "max-age=3600", headers.Get("Strict-Transport-Security"))
+		assert.Equal(t, "nosniff", headers.Get("X-Content-Type-Options"))
+		assert.Equal(t, "strict-origin-when-cross-origin", headers.Get("Referrer-Policy"))
+		assert.Equal(t, "camera=(), geolocation=(self)", headers.Get("Permissions-Policy"))
+		assert.Equal(t, "same-origin", headers.Get("Cross-Origin-Opener-Policy"))
+		assert.Equal(t, "", headers.Get("Cross-Origin-Embedder-Policy"))
+		assert.Equal(t, "same-origin", headers.Get("Cross-Origin-Resource-Policy"))
+		assert.Equal(t, "DENY", headers.Get("X-Frame-Options"))
+	})
+
+	t.Run("Omits disabled headers", func(t *testing.T) {
+		o := newOptions()
+		o.NoTLS = true
+		o.NoContentTypeOptions = true
+		o.NoReferrerPolicy = true
+		o.NoPermissionsPolicy = true
+		o.NoCrossOrigin = true
+		o.NoFrameOptions = true
+
+		headers := get(Headers(ok, o))
+		for _, k := range []string{"Strict-Transport-Security", "X-Content-Type-Options", "Referrer-Policy",
+			"Permissions-Policy", "Cross-Origin-Opener-Policy", "Cross-Origin-Resource-Policy", "X-Frame-Options"} {
+			assert.Equal(t, "", headers.Get(k), k)
+		}
+	})
+
+	t.Run("Allows endpoints to override headers", func(t *testing.T) {
+		h := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.Header().Set("X-Frame-Options", "SAMEORIGIN")
+		})
+
+		headers := get(Headers(h, newOptions()))
+		assert.Equal(t, "SAMEORIGIN", headers.Get("X-Frame-Options"))
+	})
+}
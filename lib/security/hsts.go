@@ -0,0 +1,29 @@
+package security
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/ryankurte/go-api/lib/options"
+)
+
+// HSTS builds an HTTP Strict Transport Security (HSTS) handler around the provided handler.
+// Headers are only emitted where TLS is enabled on the server.
+func HSTS(h http.Handler, o *options.Base) http.Handler {
+	if o.NoTLS || o.HSTS.NoHSTS {
+		return h
+	}
+
+	value := fmt.Sprintf("max-age=%d", int64(o.HSTS.MaxAge.Seconds()))
+	if o.HSTS.IncludeSubdomains {
+		value += "; includeSubDomains"
+	}
+	if o.HSTS.Preload {
+		value += "; preload"
+	}
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Strict-Transport-Security", value)
+		h.ServeHTTP(rw, req)
+	})
+}
@@ -0,0 +1,92 @@
+package security
+
+import (
+	"crypto/x509"
+	"net/http"
+	"path"
+)
+
+// PeerIdentity is the identity of a client verified via mutual TLS
+type PeerIdentity struct {
+	// Subject distinguished name
+	Subject string
+	// Subject common name
+	CommonName string
+	// Subject alternative names
+	DNSNames       []string
+	EmailAddresses []string
+	IPAddresses    []string
+	URIs           []string
+	// Verified client certificate
+	Certificate *x509.Certificate
+}
+
+// NewPeerIdentity creates a peer identity from a client certificate
+func NewPeerIdentity(cert *x509.Certificate) *PeerIdentity {
+	p := PeerIdentity{
+		Subject:        cert.Subject.String(),
+		CommonName:     cert.Subject.CommonName,
+		DNSNames:       cert.DNSNames,
+		EmailAddresses: cert.EmailAddresses,
+		IPAddresses:    make([]string, len(cert.IPAddresses)),
+		URIs:           make([]string, len(cert.URIs)),
+		Certificate:    cert,
+	}
+	for i, ip := range cert.IPAddresses {
+		p.IPAddresses[i] = ip.String()
+	}
+	for i, u := range cert.URIs {
+		p.URIs[i] = u.String()
+	}
+	return &p
+}
+
+// GetPeerIdentity fetches the verified peer identity for a request.
+// This returns nil where no client certificate was verified.
+func GetPeerIdentity(req *http.Request) *PeerIdentity {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return NewPeerIdentity(req.TLS.VerifiedChains[0][0])
+}
+
+// SANs returns all subject alternative names for the peer
+func (p *PeerIdentity) SANs() []string {
+	sans := make([]string, 0)
+	sans = append(sans, p.DNSNames...)
+	sans = append(sans, p.EmailAddresses...)
+	sans = append(sans, p.IPAddresses...)
+	sans = append(sans, p.URIs...)
+	return sans
+}
+
+// Matches checks a peer identity against allowed subject and SAN glob patterns.
+// Subject patterns match against the common name or full subject, and an identity
+// is allowed if any pattern matches or no patterns are provided.
+func (p *PeerIdentity) Matches(subjects, sans []string) bool {
+	if len(subjects) == 0 && len(sans) == 0 {
+		return true
+	}
+
+	for _, pattern := range subjects {
+		if matchAny(pattern, p.CommonName, p.Subject) {
+			return true
+		}
+	}
+	for _, pattern := range sans {
+		if matchAny(pattern, p.SANs()...) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchAny(pattern string, values ...string) bool {
+	for _, v := range values {
+		if ok, _ := path.Match(pattern, v); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,258 @@
+package security
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/ryankurte/go-api/lib/options"
+)
+
+// Policy is the set of CORS, CSP and CSRF options applied to a route
+type Policy struct {
+	CORS options.CORS
+	CSP  options.CSP
+	CSRF options.CSRF
+}
+
+// PolicyOption overrides CORS, CSP or CSRF options for a router or endpoint.
+// Options are applied over those in options.Base, then those of any parent routers.
+type PolicyOption func(p *Policy)
+
+// AllowOrigins overrides the allowed CORS origins
+func AllowOrigins(origins ...string) PolicyOption {
+	return func(p *Policy) { p.CORS.AllowedOrigins = origins }
+}
+
+// AllowMethods overrides the allowed CORS methods
+func AllowMethods(methods ...string) PolicyOption {
+	return func(p *Policy) { p.CORS.AllowedMethods = methods }
+}
+
+// AllowHeaders overrides the allowed CORS headers
+func AllowHeaders(headers ...string) PolicyOption {
+	return func(p *Policy) { p.CORS.AllowedHeaders = headers }
+}
+
+// AllowOriginFunc sets a validator for origins not matched by the allowed CORS origins
+func AllowOriginFunc(validator options.OriginValidator) PolicyOption {
+	return func(p *Policy) { p.CORS.OriginValidator = validator }
+}
+
+// ExposeHeaders overrides the CORS response headers exposed to clients
+func ExposeHeaders(headers ...string) PolicyOption {
+	return func(p *Policy) { p.CORS.ExposedHeaders = headers }
+}
+
+// AllowCredentials overrides whether CORS requests may include credentials
+func AllowCredentials(allow bool) PolicyOption {
+	return func(p *Policy) { p.CORS.AllowCredentials = allow }
+}
+
+// CSPSources overrides the sources for a CSP fetch directive (ie. "script-src").
+// Unknown directives are ignored.
+func CSPSources(directive string, sources ...string) PolicyOption {
+	return func(p *Policy) {
+		if d := cspDirective(&p.CSP, directive); d != nil {
+			*d = sources
+		}
+	}
+}
+
+// CSPReportOnly overrides whether the CSP is applied in report only mode
+func CSPReportOnly(reportOnly bool) PolicyOption {
+	return func(p *Policy) { p.CSP.ReportOnly = reportOnly }
+}
+
+// CSRFExempt disables CSRF protection (ie. for API key authenticated routes).
+// As exempt routes are not protected against CSRF, cookie authenticators (ie. auth.Session)
+// do not authenticate requests to these routes (see IsCSRFExempt).
+func CSRFExempt() PolicyOption {
+	return func(p *Policy) { p.CSRF.Exempt = true }
+}
+
+func cspDirective(c *options.CSP, directive string) *[]string {
+	switch directive {
+	case "default-src":
+		return &c.DefaultSrc
+	case "script-src":
+		return &c.ScriptSrc
+	case "style-src":
+		return &c.StyleSrc
+	case "img-src":
+		return &c.ImgSrc
+	case "font-src":
+		return &c.FontSrc
+	case "child-src":
+		return &c.ChildSrc
+	case "connect-src":
+		return &c.ConnectSrc
+	case "frame-src":
+		return &c.FrameSrc
+	case "manifest-src":
+		return &c.ManifestSrc
+	case "media-src":
+		return &c.MediaSrc
+	case "object-src":
+		return &c.ObjectSrc
+	case "worker-src":
+		return &c.WorkerSrc
+	default:
+		return nil
+	}
+}
+
+// policyRule binds policy options to a route template, or to all routes under a prefix
+type policyRule struct {
+	segments []string
+	prefix   bool
+	method   string
+	opts     []PolicyOption
+}
+
+// PolicySet collects policy overrides for routers and endpoints
+type PolicySet struct {
+	rules []policyRule
+}
+
+// NewPolicySet creates an empty policy set
+func NewPolicySet() *PolicySet {
+	return &PolicySet{rules: make([]policyRule, 0)}
+}
+
+// AddPrefix binds policy options to all routes under the provided prefix
+func (s *PolicySet) AddPrefix(prefix string, opts ...PolicyOption) {
+	s.rules = append(s.rules, policyRule{segments: splitRoute(prefix), prefix: true, opts: opts})
+}
+
+// AddRoute binds policy options to a route template (ie. "/users/:id") and method
+func (s *PolicySet) AddRoute(route, method string, opts ...PolicyOption) {
+	s.rules = append(s.rules, policyRule{segments: splitRoute(route), method: method, opts: opts})
+}
+
+func splitRoute(route string) []string {
+	route = strings.Trim(route, "/")
+	if route == "" {
+		return []string{}
+	}
+	return strings.Split(route, "/")
+}
+
+// matchSegments checks whether the path segments match the template segments,
+// with ":param" segments matching any single segment and "*" matching any remainder
+func matchSegments(template, path []string, prefix bool) bool {
+	for i, t := range template {
+		if t == "*" {
+			return true
+		}
+		if i >= len(path) {
+			return false
+		}
+		if !strings.HasPrefix(t, ":") && t != path[i] {
+			return false
+		}
+	}
+	return prefix || len(template) == len(path)
+}
+
+// segmentRank orders template segments by specificity, with literal segments
+// more specific than ":param" segments, which are more specific than "*"
+func segmentRank(segment string) int {
+	switch {
+	case segment == "*":
+		return 0
+	case strings.HasPrefix(segment, ":"):
+		return 1
+	default:
+		return 2
+	}
+}
+
+// moreSpecific checks whether rule a is more specific than rule b, preferring route rules over prefix rules,
+// longer prefixes over shorter ones, then literal segments over parameters at the first differing segment
+// (ie. "/users/me" over "/users/:id") and exact routes over trailing "*" regardless of registration order.
+func moreSpecific(a, b policyRule) bool {
+	if a.prefix != b.prefix {
+		return !a.prefix
+	}
+	if a.prefix && len(a.segments) != len(b.segments) {
+		return len(a.segments) > len(b.segments)
+	}
+	for i := 0; i < len(a.segments) && i < len(b.segments); i++ {
+		if ra, rb := segmentRank(a.segments[i]), segmentRank(b.segments[i]); ra != rb {
+			return ra > rb
+		}
+	}
+	// Where both match, any remaining segment is a trailing "*"
+	return len(a.segments) < len(b.segments)
+}
+
+// match finds the most specific rule for the provided path and method (see moreSpecific),
+// using registration order only to break ties between equally specific rules.
+func (s *PolicySet) match(path []string, method string) int {
+	best := -1
+	for i, r := range s.rules {
+		if !r.prefix && r.method != method {
+			continue
+		}
+		if !matchSegments(r.segments, path, r.prefix) {
+			continue
+		}
+		if best < 0 || moreSpecific(r, s.rules[best]) {
+			best = i
+		}
+	}
+	return best
+}
+
+// resolve builds the options for a rule, applying options from the enclosing prefix rules first
+func (s *PolicySet) resolve(o *options.Base, index int) *options.Base {
+	rule := s.rules[index]
+	p := Policy{CORS: o.CORS, CSP: o.CSP, CSRF: o.CSRF}
+
+	for length := 0; length <= len(rule.segments); length++ {
+		for _, r := range s.rules {
+			if r.prefix && len(r.segments) == length && matchSegments(r.segments, rule.segments, true) {
+				for _, opt := range r.opts {
+					opt(&p)
+				}
+			}
+		}
+	}
+	if !rule.prefix {
+		for _, opt := range rule.opts {
+			opt(&p)
+		}
+	}
+
+	resolved := *o
+	resolved.CORS, resolved.CSP, resolved.CSRF = p.CORS, p.CSP, p.CSRF
+	return &resolved
+}
+
+// PolicyHandler builds security handlers for the default options and each policy override using the provided
+// build function, dispatching requests to the handler for the most specific policy matching the request route.
+// Preflight requests are matched using the requested method.
+func PolicyHandler(h http.Handler, o *options.Base, s *PolicySet, build func(h http.Handler, o *options.Base) http.Handler) http.Handler {
+	defaultHandler := build(h, o)
+	if s == nil || len(s.rules) == 0 {
+		return defaultHandler
+	}
+
+	handlers := make([]http.Handler, len(s.rules))
+	for i := range s.rules {
+		handlers[i] = build(h, s.resolve(o, i))
+	}
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		method := req.Method
+		if m := req.Header.Get("Access-Control-Request-Method"); method == http.MethodOptions && m != "" {
+			method = m
+		}
+
+		if i := s.match(splitRoute(req.URL.Path), method); i >= 0 {
+			handlers[i].ServeHTTP(rw, req)
+			return
+		}
+		defaultHandler.ServeHTTP(rw, req)
+	})
+}
@@ -0,0 +1,99 @@
+package security
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ryankurte/go-api/lib/options"
+)
+
+func TestPolicies(t *testing.T) {
+	o := options.Base{}
+	o.AllowedOrigins = []string{"https://example.com"}
+	o.AllowedMethods = []string{http.MethodGet, http.MethodPost}
+	o.AllowedHeaders = []string{"Content-Type"}
+	o.CSP.DefaultSrc = []string{"'self'"}
+
+	s := NewPolicySet()
+	s.AddPrefix("/admin", CSPSources("default-src", "'none'"), CSPSources("script-src", "'self'"))
+	s.AddRoute("/admin/users/:id", http.MethodGet, CSPSources("img-src", "'self'", "data:"))
+	s.AddRoute("/widget", http.MethodGet, AllowOrigins("*"))
+
+	h := PolicyHandler(http.NotFoundHandler(), &o, s, func(h http.Handler, o *options.Base) http.Handler {
+		return CSP(CORS(h, o), o)
+	})
+
+	request := func(method, path, origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, req)
+		return rw
+	}
+
+	t.Run("Applies default policies", func(t *testing.T) {
+		rw := request(http.MethodGet, "/users", "https://example.com")
+		assert.Equal(t, "default-src 'self'", rw.Header().Get("Content-Security-Policy"))
+		assert.Equal(t, "https://example.com", rw.Header().Get("Access-Control-Allow-Origin"))
+
+		rw = request(http.MethodGet, "/users", "https://other.com")
+		assert.Equal(t, "", rw.Header().Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("Applies router policies", func(t *testing.T) {
+		rw := request(http.MethodGet, "/admin/settings", "")
+		assert.Equal(t, "default-src 'none'; script-src 'self'", rw.Header().Get("Content-Security-Policy"))
+	})
+
+	t.Run("Applies endpoint policies over router policies", func(t *testing.T) {
+		rw := request(http.MethodGet, "/admin/users/12", "")
+		assert.Equal(t, "default-src 'none'; script-src 'self'; img-src 'self' data:", rw.Header().Get("Content-Security-Policy"))
+
+		rw = request(http.MethodPost, "/admin/users/12", "")
+		assert.Equal(t, "default-src 'none'; script-src 'self'", rw.Header().Get("Content-Security-Policy"))
+	})
+
+	t.Run("Applies endpoint policies to preflight requests", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodOptions, "/widget", nil)
+		req.Header.Set("Origin", "https://other.com")
+		req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, req)
+		assert.Equal(t, "*", rw.Header().Get("Access-Control-Allow-Origin"))
+
+		rw = request(http.MethodGet, "/widget", "https://other.com")
+		assert.Equal(t, "*", rw.Header().Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("Prefers literal route segments over parameters", func(t *testing.T) {
+		for _, literalFirst := range []bool{true, false} {
+			s := NewPolicySet()
+			if literalFirst {
+				s.AddRoute("/users/me", http.MethodGet, CSPSources("img-src", "'none'"))
+			}
+			s.AddRoute("/users/:id", http.MethodGet, CSPSources("img-src", "data:"))
+			s.AddRoute("/users/:id/*", http.MethodGet, CSPSources("img-src", "*"))
+			if !literalFirst {
+				s.AddRoute("/users/me", http.MethodGet, CSPSources("img-src", "'none'"))
+			}
+
+			h := PolicyHandler(http.NotFoundHandler(), &o, s, func(h http.Handler, o *options.Base) http.Handler {
+				return CSP(h, o)
+			})
+			get := func(path string) string {
+				rw := httptest.NewRecorder()
+				h.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, path, nil))
+				return rw.Header().Get("Content-Security-Policy")
+			}
+
+			assert.Equal(t, "default-src 'self'; img-src 'none'", get("/users/me"))
+			assert.Equal(t, "default-src 'self'; img-src data:", get("/users/12"))
+			assert.Equal(t, "default-src 'self'; img-src *", get("/users/12/avatar"))
+		}
+	})
+}
@@ -0,0 +1,68 @@
+package servers
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+
+	"github.com/ryankurte/go-api/lib/options"
+)
+
+// NewACMEManager creates an ACME certificate manager with the provided options.
+// The returned manager handles TLS-ALPN-01 challenges through its TLS configuration
+// and HTTP-01 challenges through its HTTP handler.
+func NewACMEManager(o *options.Base) (*autocert.Manager, error) {
+	if o.ACME.CacheDir == "" {
+		return nil, fmt.Errorf("ACME certificate cache directory must be specified")
+	}
+
+	hosts := o.ACME.Hosts
+	if len(hosts) == 0 {
+		host, _, err := net.SplitHostPort(o.ExternalAddress)
+		if err != nil {
+			host = o.ExternalAddress
+		}
+		if host == "" {
+			return nil, fmt.Errorf("ACME hosts or external address must be specified")
+		}
+		hosts = []string{host}
+	}
+
+	client := &acme.Client{
+		DirectoryURL: o.ACME.DirectoryURL,
+	}
+
+	// Trust the provided CA when connecting to the ACME directory
+	if o.ACME.CACert != "" {
+		pem, err := ioutil.ReadFile(o.ACME.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading ACME CA certificate (%s)", err)
+		}
+		pool := x509.NewCertPool()
+		if ok := pool.AppendCertsFromPEM(pem); !ok {
+			return nil, fmt.Errorf("No certificates found in ACME CA certificate file '%s'", o.ACME.CACert)
+		}
+		client.HTTPClient = &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{RootCAs: pool},
+			},
+		}
+	}
+
+	m := autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(o.ACME.CacheDir),
+		HostPolicy: autocert.HostWhitelist(hosts...),
+		Email:      o.ACME.Email,
+		Client:     client,
+	}
+
+	return &m, nil
+}
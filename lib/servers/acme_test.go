@@ -0,0 +1,90 @@
+package servers
+
+import (
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ryankurte/go-api/lib/options"
+)
+
+func TestACME(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "go-api-acme")
+	require.Nil(t, err)
+	defer os.RemoveAll(cacheDir)
+
+	t.Run("Defaults hosts to external address", func(t *testing.T) {
+		o := options.Base{ExternalAddress: "api.example.com:443"}
+		o.ACME.CacheDir = cacheDir
+
+		m, err := NewACMEManager(&o)
+		require.Nil(t, err)
+
+		assert.Nil(t, m.HostPolicy(context.Background(), "api.example.com"))
+		assert.NotNil(t, m.HostPolicy(context.Background(), "other.example.com"))
+	})
+
+	t.Run("Requires cache directory", func(t *testing.T) {
+		o := options.Base{ExternalAddress: "api.example.com"}
+
+		_, err := NewACMEManager(&o)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("Rejects invalid CA certificate", func(t *testing.T) {
+		o := options.Base{ExternalAddress: "api.example.com"}
+		o.ACME.CacheDir = cacheDir
+		o.ACME.CACert = "./missing.pem"
+
+		_, err := NewACMEManager(&o)
+		assert.NotNil(t, err)
+	})
+
+	// Issuance against a local ACME server such as Pebble, for example:
+	// PEBBLE_DIRECTORY=https://localhost:14000/dir PEBBLE_CA=./pebble.minica.pem
+	// Listeners are bound to ephemeral ports, so Pebble must be run with PEBBLE_VA_ALWAYS_VALID=1
+	directory, ca := os.Getenv("PEBBLE_DIRECTORY"), os.Getenv("PEBBLE_CA")
+	if directory == "" || ca == "" {
+		t.Log("PEBBLE_DIRECTORY and PEBBLE_CA not set, skipping issuance test")
+		return
+	}
+
+	t.Run("Issues certificates via local ACME server", func(t *testing.T) {
+		o := options.Base{BindAddress: "127.0.0.1", Port: "0", ExternalAddress: "localhost"}
+		o.ACME.Enabled = true
+		o.ACME.DirectoryURL = directory
+		o.ACME.CACert = ca
+		o.ACME.CacheDir = cacheDir
+		o.ACME.HTTPAddress = "127.0.0.1:0"
+
+		s := NewHTTP(&o, http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {}))
+		s.Start()
+		defer s.Close()
+		_, port, err := net.SplitHostPort(serverAddress(t, s))
+		require.Nil(t, err)
+
+		var resp *http.Response
+		client := http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+		for i := 0; i < 20; i++ {
+			resp, err = client.Get("https://localhost:" + port + "/")
+			if err == nil {
+				break
+			}
+			time.Sleep(500 * time.Millisecond)
+		}
+		require.Nil(t, err)
+		resp.Body.Close()
+
+		require.NotNil(t, resp.TLS)
+		require.NotEmpty(t, resp.TLS.PeerCertificates)
+		assert.Contains(t, resp.TLS.PeerCertificates[0].DNSNames, "localhost")
+	})
+}
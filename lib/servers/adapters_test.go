@@ -0,0 +1,264 @@
+package servers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ryankurte/go-api/lib/logging"
+	"github.com/ryankurte/go-api/lib/options"
+	"github.com/ryankurte/go-api/lib/wrappers"
+)
+
+// Handler echoing request details for adapter mapping tests
+var echoHandler = http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == "/binary" {
+		rw.Header().Set("Content-Type", "application/octet-stream")
+		rw.Write([]byte{0xff, 0xfe, 0x00, 0x01})
+		return
+	}
+
+	body, _ := ioutil.ReadAll(req.Body)
+
+	rw.Header().Add("X-Values", "a")
+	rw.Header().Add("X-Values", "b")
+	rw.WriteHeader(http.StatusCreated)
+	fmt.Fprintf(rw, "%s %s %s %v %s", req.Method, req.URL.Path, req.URL.RawQuery, req.Header["X-Test"], body)
+})
+
+// adapter invokes a handler via a server adapter, returning the mapped response
+type adapter func(t *testing.T, h http.Handler, inv Invocation) *InvocationResponse
+
+func lambdaAdapter(t *testing.T, h http.Handler, inv Invocation) *InvocationResponse {
+	l := NewLambda(&options.Base{}, h)
+
+	resp, err := l.handle(context.Background(), events.APIGatewayProxyRequest{
+		HTTPMethod:                      inv.Method,
+		Path:                            inv.Path,
+		MultiValueQueryStringParameters: inv.Query,
+		MultiValueHeaders:               inv.Headers,
+		Body:                            inv.Body,
+		IsBase64Encoded:                 inv.IsBase64Encoded,
+		RequestContext:                  events.APIGatewayProxyRequestContext{RequestID: inv.RequestID},
+	})
+	require.Nil(t, err)
+
+	return &InvocationResponse{
+		StatusCode:      resp.StatusCode,
+		Headers:         resp.MultiValueHeaders,
+		Body:            resp.Body,
+		IsBase64Encoded: resp.IsBase64Encoded,
+	}
+}
+
+func functionAdapter(t *testing.T, h http.Handler, inv Invocation) *InvocationResponse {
+	data, err := json.Marshal(inv)
+	require.Nil(t, err)
+
+	rw := httptest.NewRecorder()
+	FunctionHandler(h, 0).ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(data)))
+	require.Equal(t, http.StatusOK, rw.Code)
+
+	resp := InvocationResponse{}
+	require.Nil(t, json.Unmarshal(rw.Body.Bytes(), &resp))
+	return &resp
+}
+
+func cloudEventsBinaryAdapter(t *testing.T, h http.Handler, inv Invocation) *InvocationResponse {
+	data, err := json.Marshal(inv)
+	require.Nil(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("ce-specversion", CloudEventsSpecVersion)
+	req.Header.Set("ce-id", "event-id")
+	req.Header.Set("ce-source", "test")
+	req.Header.Set("ce-type", "test.invocation")
+
+	return readCloudEventResponse(t, h, req)
+}
+
+func cloudEventsStructuredAdapter(t *testing.T, h http.Handler, inv Invocation) *InvocationResponse {
+	data, err := json.Marshal(inv)
+	require.Nil(t, err)
+
+	event, err := json.Marshal(CloudEvent{
+		SpecVersion: CloudEventsSpecVersion,
+		ID:          "event-id",
+		Source:      "test",
+		Type:        "test.invocation",
+		Data:        data,
+	})
+	require.Nil(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(event))
+	req.Header.Set("Content-Type", CloudEventsContentType)
+
+	return readCloudEventResponse(t, h, req)
+}
+
+func readCloudEventResponse(t *testing.T, h http.Handler, req *http.Request) *InvocationResponse {
+	rw := httptest.NewRecorder()
+	CloudEventsHandler(h, "https://example.com", 0).ServeHTTP(rw, req)
+	require.Equal(t, http.StatusOK, rw.Code, rw.Body.String())
+
+	assert.Equal(t, CloudEventsSpecVersion, rw.Header().Get("ce-specversion"))
+	assert.Equal(t, "event-id", rw.Header().Get("ce-id"))
+	assert.Equal(t, "https://example.com", rw.Header().Get("ce-source"))
+	assert.Equal(t, CloudEventsResponseType, rw.Header().Get("ce-type"))
+
+	resp := InvocationResponse{}
+	require.Nil(t, json.Unmarshal(rw.Body.Bytes(), &resp))
+	return &resp
+}
+
+func TestAdapters(t *testing.T) {
+	adapters := map[string]adapter{
+		"lambda":                 lambdaAdapter,
+		"function":               functionAdapter,
+		"cloudevents binary":     cloudEventsBinaryAdapter,
+		"cloudevents structured": cloudEventsStructuredAdapter,
+	}
+
+	for name, a := range adapters {
+		t.Run(name, func(t *testing.T) {
+
+			t.Run("Maps requests with query parameters", func(t *testing.T) {
+				resp := a(t, echoHandler, Invocation{
+					Method: http.MethodGet,
+					Path:   "/test",
+					Query:  map[string][]string{"a": {"1", "2"}},
+				})
+				assert.Equal(t, "GET /test a=1&a=2 [] ", resp.Body)
+			})
+
+			t.Run("Maps request bodies", func(t *testing.T) {
+				resp := a(t, echoHandler, Invocation{
+					Method:  http.MethodPost,
+					Path:    "/test",
+					Headers: map[string][]string{"Content-Type": {"application/json"}},
+					Body:    `{"name":"test"}`,
+				})
+				assert.Equal(t, `POST /test  [] {"name":"test"}`, resp.Body)
+			})
+
+			t.Run("Maps multi-value request headers", func(t *testing.T) {
+				resp := a(t, echoHandler, Invocation{
+					Method:  http.MethodGet,
+					Path:    "/test",
+					Headers: map[string][]string{"X-Test": {"a", "b"}},
+				})
+				assert.Equal(t, "GET /test  [a b] ", resp.Body)
+			})
+
+			t.Run("Maps response status and headers", func(t *testing.T) {
+				resp := a(t, echoHandler, Invocation{Method: http.MethodGet, Path: "/test"})
+				assert.Equal(t, http.StatusCreated, resp.StatusCode)
+				assert.Equal(t, []string{"a", "b"}, resp.Headers["X-Values"])
+			})
+
+			t.Run("Decodes base64 request bodies", func(t *testing.T) {
+				resp := a(t, echoHandler, Invocation{
+					Method:          http.MethodPut,
+					Path:            "/test",
+					Body:            base64.StdEncoding.EncodeToString([]byte("binary")),
+					IsBase64Encoded: true,
+				})
+				assert.Equal(t, "PUT /test  [] binary", resp.Body)
+			})
+
+			t.Run("Propagates platform request IDs", func(t *testing.T) {
+				h := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+					rw.Write([]byte(req.Header.Get(logging.RequestIDHeader)))
+				})
+				resp := a(t, h, Invocation{RequestID: "request-id", Method: http.MethodGet, Path: "/test"})
+				assert.Equal(t, "request-id", resp.Body)
+
+				headers := map[string][]string{logging.RequestIDHeader: {"client-id"}}
+				resp = a(t, h, Invocation{RequestID: "request-id", Method: http.MethodGet, Path: "/test", Headers: headers})
+				assert.Equal(t, "request-id", resp.Body)
+			})
+
+			t.Run("Recovers handler panics", func(t *testing.T) {
+				h := wrappers.Recover(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+					panic("test")
+				}))
+				resp := a(t, h, Invocation{Method: http.MethodGet, Path: "/test"})
+				assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+			})
+
+			t.Run("Encodes binary response bodies", func(t *testing.T) {
+				resp := a(t, echoHandler, Invocation{Method: http.MethodGet, Path: "/binary"})
+				assert.True(t, resp.IsBase64Encoded)
+				body, err := base64.StdEncoding.DecodeString(resp.Body)
+				require.Nil(t, err)
+				assert.Equal(t, []byte{0xff, 0xfe, 0x00, 0x01}, body)
+			})
+		})
+	}
+}
+
+func TestCloudEventsValidation(t *testing.T) {
+	h := CloudEventsHandler(echoHandler, "test", 0)
+
+	t.Run("Rejects events missing required attributes", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(`{"path":"/"}`)))
+		req.Header.Set("ce-specversion", CloudEventsSpecVersion)
+		req.Header.Set("ce-id", "event-id")
+
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, req)
+		assert.Equal(t, http.StatusBadRequest, rw.Code)
+	})
+
+	t.Run("Rejects unsupported spec versions", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(`{"path":"/"}`)))
+		req.Header.Set("ce-specversion", "0.3")
+		req.Header.Set("ce-id", "event-id")
+		req.Header.Set("ce-source", "test")
+		req.Header.Set("ce-type", "test")
+
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, req)
+		assert.Equal(t, http.StatusBadRequest, rw.Code)
+	})
+}
+
+func TestInvocationLimits(t *testing.T) {
+	data, err := json.Marshal(Invocation{Method: http.MethodPost, Path: "/", Body: strings.Repeat("a", 1024)})
+	require.Nil(t, err)
+
+	t.Run("Limits function invocation size", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		FunctionHandler(echoHandler, 512).ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(data)))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rw.Code)
+	})
+
+	t.Run("Limits CloudEvent size", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(data))
+		req.Header.Set("ce-specversion", CloudEventsSpecVersion)
+		req.Header.Set("ce-id", "event-id")
+		req.Header.Set("ce-source", "test")
+		req.Header.Set("ce-type", "test")
+
+		rw := httptest.NewRecorder()
+		CloudEventsHandler(echoHandler, "test", 512).ServeHTTP(rw, req)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rw.Code)
+	})
+
+	t.Run("Allows for encoding overhead", func(t *testing.T) {
+		assert.Equal(t, int64(0), MaxInvocationSize(0))
+		assert.True(t, MaxInvocationSize(1024) > 1024*4/3)
+	})
+}
@@ -0,0 +1,23 @@
+package servers
+
+import (
+	"net/http"
+
+	"github.com/ryankurte/go-api/lib/options"
+)
+
+// NewAdmin creates an internal admin server bound to the configured admin address.
+// This is served without TLS so should only be bound to addresses reachable from trusted networks.
+// The admin listener is handed over along with the API server on graceful restart.
+func NewAdmin(o *options.Base, h http.Handler) *HTTP {
+	ao := *o
+	ao.Listen = []string{o.Admin.Address}
+	// Restarts are triggered via the API server
+	ao.GracefulRestart = false
+
+	return &HTTP{
+		Base:      NewBase("admin", h, &ao),
+		cleartext: true,
+		done:      make(chan struct{}),
+	}
+}
@@ -2,6 +2,7 @@ package servers
 
 import (
 	"net/http"
+	"sync/atomic"
 
 	log "github.com/sirupsen/logrus"
 
@@ -12,14 +13,25 @@ import (
 type Handler interface {
 	Run()
 	Close()
+	State() string
 }
 
+// Server state constants
+const (
+	StateStarting   = "starting"
+	StateRunning    = "running"
+	StateRestarting = "restarting"
+	StateDraining   = "draining"
+	StateStopped    = "stopped"
+)
+
 // Base handler type
 type Base struct {
 	name    string
 	options *options.Base
 	logger  log.FieldLogger
 	handler http.Handler
+	state   *atomic.Value
 }
 
 // NewBase creates a new base handler
@@ -29,8 +41,22 @@ func NewBase(name string, handler http.Handler, options *options.Base) Base {
 		name:    name,
 		options: options,
 		handler: handler,
-		logger:  log.New().WithField("module", name),
+		logger:  options.GetLogger().WithField("module", name),
+		state:   &atomic.Value{},
 	}
+	b.state.Store(StateStarting)
 
 	return b
 }
+
+// State fetches the current server state
+func (b *Base) State() string {
+	return b.state.Load().(string)
+}
+
+// setState updates and reports the server state
+func (b *Base) setState(state string) {
+	if b.state.Swap(state) != state {
+		b.logger.Infof("Server state: %s", state)
+	}
+}
@@ -0,0 +1,121 @@
+package servers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+
+	"github.com/ryankurte/go-api/lib/options"
+)
+
+// CloudEvents content types and attributes
+const (
+	CloudEventsContentType  = "application/cloudevents+json"
+	CloudEventsSpecVersion  = "1.0"
+	CloudEventsResponseType = "com.github.ryankurte.go-api.response"
+)
+
+// CloudEvent is a structured mode CloudEvent
+type CloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	DataContentType string          `json:"datacontenttype,omitempty"`
+	Data            json.RawMessage `json:"data,omitempty"`
+	DataBase64      string          `json:"data_base64,omitempty"`
+}
+
+// NewCloudEvents creates a CloudEvents adapter, accepting events via HTTP in binary or structured mode
+// with invocations as event data, and responding with binary mode events containing invocation responses.
+// As with NewFunction this is served without TLS.
+func NewCloudEvents(o *options.Base, h http.Handler) *HTTP {
+	return &HTTP{
+		Base:      NewBase(options.ModeCloudEvents, CloudEventsHandler(h, o.ExternalAddress, MaxInvocationSize(o.MaxBodySize)), o),
+		cleartext: true,
+		done:      make(chan struct{}),
+	}
+}
+
+// CloudEventsHandler creates an http.Handler accepting CloudEvents of up to maxSize bytes containing invocations
+// (see MaxInvocationSize, 0 for no limit), calling the provided handler and responding with a CloudEvent containing the invocation response.
+func CloudEventsHandler(h http.Handler, source string, maxSize int64) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			http.Error(rw, "CloudEvents must be delivered via POST", http.StatusMethodNotAllowed)
+			return
+		}
+		limitInvocation(rw, req, maxSize)
+
+		e, err := parseCloudEvent(req)
+		if err != nil {
+			invocationError(rw, "Invalid CloudEvent (%s)", err)
+			return
+		}
+
+		data := []byte(e.Data)
+		if e.DataBase64 != "" {
+			data, err = base64.StdEncoding.DecodeString(e.DataBase64)
+			if err != nil {
+				http.Error(rw, fmt.Sprintf("Invalid CloudEvent data (%s)", err), http.StatusBadRequest)
+				return
+			}
+		}
+
+		inv := Invocation{}
+		if err := json.Unmarshal(data, &inv); err != nil {
+			http.Error(rw, fmt.Sprintf("Invalid function invocation (%s)", err), http.StatusBadRequest)
+			return
+		}
+		if inv.RequestID == "" {
+			inv.RequestID = e.ID
+		}
+
+		// Respond in binary mode
+		rw.Header().Set("ce-specversion", CloudEventsSpecVersion)
+		rw.Header().Set("ce-id", e.ID)
+		rw.Header().Set("ce-source", source)
+		rw.Header().Set("ce-type", CloudEventsResponseType)
+
+		writeInvocationResponse(rw, h, inv)
+	})
+}
+
+func parseCloudEvent(req *http.Request) (*CloudEvent, error) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	e := CloudEvent{}
+	contentType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+
+	if contentType == CloudEventsContentType {
+		// Structured mode, attributes and data in body
+		if err := json.Unmarshal(body, &e); err != nil {
+			return nil, err
+		}
+	} else {
+		// Binary mode, attributes in headers and data in body
+		e = CloudEvent{
+			SpecVersion:     req.Header.Get("ce-specversion"),
+			ID:              req.Header.Get("ce-id"),
+			Source:          req.Header.Get("ce-source"),
+			Type:            req.Header.Get("ce-type"),
+			DataContentType: contentType,
+			Data:            body,
+		}
+	}
+
+	if e.SpecVersion != CloudEventsSpecVersion {
+		return nil, fmt.Errorf("unsupported specversion '%s'", e.SpecVersion)
+	}
+	if e.ID == "" || e.Source == "" || e.Type == "" {
+		return nil, fmt.Errorf("id, source and type attributes are required")
+	}
+
+	return &e, nil
+}
@@ -0,0 +1,18 @@
+package servers
+
+import (
+	"net/http"
+
+	"github.com/ryankurte/go-api/lib/options"
+)
+
+// NewFunction creates a generic function adapter, accepting JSON encoded invocations via HTTP POST
+// and responding with JSON encoded invocation responses. This is served without TLS, for use
+// with function platforms and local stand-ins that invoke functions over HTTP.
+func NewFunction(o *options.Base, h http.Handler) *HTTP {
+	return &HTTP{
+		Base:      NewBase(options.ModeFunction, FunctionHandler(h, MaxInvocationSize(o.MaxBodySize)), o),
+		cleartext: true,
+		done:      make(chan struct{}),
+	}
+}
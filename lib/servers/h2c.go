@@ -0,0 +1,19 @@
+package servers
+
+import (
+	"net/http"
+
+	"github.com/ryankurte/go-api/lib/options"
+)
+
+// NewH2C creates a new HTTP server supporting HTTP/2 over cleartext (h2c).
+// This is intended for deployments behind TLS terminating proxies that speak HTTP/2 upstream,
+// and serves without TLS regardless of TLS options.
+func NewH2C(o *options.Base, h http.Handler) *HTTP {
+	return &HTTP{
+		Base:      NewBase(options.ModeH2C, h, o),
+		cleartext: true,
+		h2c:       true,
+		done:      make(chan struct{}),
+	}
+}
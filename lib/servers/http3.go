@@ -0,0 +1,30 @@
+package servers
+
+import (
+	"net/http"
+
+	"github.com/quic-go/quic-go/http3"
+
+	"github.com/ryankurte/go-api/lib/options"
+)
+
+// NewHTTP3 creates a new HTTP server with HTTP/3 (QUIC) served alongside TLS on the same port.
+// Responses over TCP advertise the HTTP/3 endpoint via the Alt-Svc header.
+func NewHTTP3(o *options.Base, h http.Handler) *HTTP {
+	s := HTTP{
+		quic: &http3.Server{Handler: h},
+		done: make(chan struct{}),
+	}
+
+	// Advertise HTTP/3 support to clients connecting via TCP
+	altSvc := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.ProtoMajor < 3 {
+			s.quic.SetQUICHeaders(rw.Header())
+		}
+		h.ServeHTTP(rw, req)
+	})
+
+	s.Base = NewBase(options.ModeHTTP3, altSvc, o)
+
+	return &s
+}
@@ -0,0 +1,176 @@
+package servers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"unicode/utf8"
+
+	"github.com/ryankurte/go-api/lib/logging"
+)
+
+// Invocation is a generic function invocation describing an HTTP request
+type Invocation struct {
+	RequestID       string              `json:"requestId,omitempty"`
+	Method          string              `json:"method"`
+	Path            string              `json:"path"`
+	Query           map[string][]string `json:"query,omitempty"`
+	Headers         map[string][]string `json:"headers,omitempty"`
+	Body            string              `json:"body,omitempty"`
+	IsBase64Encoded bool                `json:"isBase64Encoded,omitempty"`
+}
+
+// InvocationResponse is a generic function response describing an HTTP response
+type InvocationResponse struct {
+	StatusCode      int                 `json:"statusCode"`
+	Headers         map[string][]string `json:"headers,omitempty"`
+	Body            string              `json:"body"`
+	IsBase64Encoded bool                `json:"isBase64Encoded,omitempty"`
+}
+
+// Invoke calls the provided handler with an invocation, returning the mapped response
+func Invoke(h http.Handler, inv Invocation) (*InvocationResponse, error) {
+	req, err := mapInvocationRequest(inv)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, req)
+
+	return mapInvocationResponse(resp), nil
+}
+
+func mapInvocationRequest(inv Invocation) (*http.Request, error) {
+	u, err := url.Parse(inv.Path)
+	if err != nil {
+		return nil, err
+	}
+	if len(inv.Query) > 0 {
+		u.RawQuery = url.Values(inv.Query).Encode()
+	}
+
+	body := []byte(inv.Body)
+	if inv.IsBase64Encoded {
+		body, err = base64.StdEncoding.DecodeString(inv.Body)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid base64 request body (%s)", err)
+		}
+	}
+
+	method := inv.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range inv.Headers {
+		for _, value := range v {
+			req.Header.Add(k, value)
+		}
+	}
+	req.Host = req.Header.Get("Host")
+
+	// Propagate platform request IDs in place of any provided by the client
+	if inv.RequestID != "" {
+		req.Header.Set(logging.RequestIDHeader, inv.RequestID)
+	}
+	req.RequestURI = u.RequestURI()
+
+	return req, nil
+}
+
+func mapInvocationResponse(resp *httptest.ResponseRecorder) *InvocationResponse {
+	result := resp.Result()
+	body, _ := ioutil.ReadAll(result.Body)
+
+	r := InvocationResponse{
+		StatusCode: result.StatusCode,
+		Headers:    map[string][]string(result.Header),
+	}
+
+	// Encode non-text bodies as base64
+	if utf8.Valid(body) {
+		r.Body = string(body)
+	} else {
+		r.Body = base64.StdEncoding.EncodeToString(body)
+		r.IsBase64Encoded = true
+	}
+
+	return &r
+}
+
+// Allowance for invocation and event attributes and headers beyond the encoded request body
+const invocationOverhead = 1 << 20
+
+// MaxInvocationSize computes the maximum size of an encoded invocation (or event containing an invocation)
+// carrying a request body of up to the provided size, allowing for base64 encoding of the body and event data.
+// This returns 0 (no limit) where the body size is not limited.
+func MaxInvocationSize(maxBodySize int64) int64 {
+	if maxBodySize <= 0 {
+		return 0
+	}
+	return 2*maxBodySize + invocationOverhead
+}
+
+// limitInvocation limits the size of invocation request bodies, where a limit is set
+func limitInvocation(rw http.ResponseWriter, req *http.Request, maxSize int64) {
+	if maxSize > 0 {
+		req.Body = http.MaxBytesReader(rw, req.Body, maxSize)
+	}
+}
+
+// invocationError responds to invalid invocations, with http.StatusRequestEntityTooLarge where the size limit is exceeded
+func invocationError(rw http.ResponseWriter, format string, err error) {
+	status := http.StatusBadRequest
+	if mbe := (*http.MaxBytesError)(nil); errors.As(err, &mbe) {
+		status = http.StatusRequestEntityTooLarge
+	}
+	http.Error(rw, fmt.Sprintf(format, err), status)
+}
+
+// FunctionHandler creates an http.Handler accepting JSON encoded invocations via POST of up to maxSize bytes
+// (see MaxInvocationSize, 0 for no limit), calling the provided handler and responding with a JSON encoded invocation response.
+func FunctionHandler(h http.Handler, maxSize int64) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			http.Error(rw, "Function invocations must use POST", http.StatusMethodNotAllowed)
+			return
+		}
+		limitInvocation(rw, req, maxSize)
+
+		inv := Invocation{}
+		if err := json.NewDecoder(req.Body).Decode(&inv); err != nil {
+			invocationError(rw, "Invalid function invocation (%s)", err)
+			return
+		}
+
+		writeInvocationResponse(rw, h, inv)
+	})
+}
+
+func writeInvocationResponse(rw http.ResponseWriter, h http.Handler, inv Invocation) {
+	resp, err := Invoke(h, inv)
+	if err != nil {
+		http.Error(rw, fmt.Sprintf("Invalid function invocation (%s)", err), http.StatusBadRequest)
+		return
+	}
+
+	data, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(rw, "Function wrapper error", http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Write(data)
+}
@@ -1,17 +1,14 @@
 package servers
 
 import (
-	"bytes"
 	"context"
-	"io/ioutil"
 	"net/http"
-	"net/http/httptest"
-	"net/url"
 	"strings"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 
+	"github.com/ryankurte/go-api/lib/logging"
 	"github.com/ryankurte/go-api/lib/options"
 )
 
@@ -27,53 +24,49 @@ func NewLambda(o *options.Base, handler http.Handler) *Lambda {
 	}
 }
 
-func (h *Lambda) mapAPIGatewayRequest(req events.APIGatewayProxyRequest) (*http.Request, error) {
-	headers := make(http.Header)
-	for k, v := range req.Headers {
-		headers[k] = strings.Split(v, ";")
+// mapAPIGatewayRequest maps an API Gateway proxy request to a generic invocation
+func mapAPIGatewayRequest(req events.APIGatewayProxyRequest) Invocation {
+	inv := Invocation{
+		RequestID:       req.RequestContext.RequestID,
+		Method:          req.HTTPMethod,
+		Path:            req.Path,
+		Query:           req.MultiValueQueryStringParameters,
+		Headers:         req.MultiValueHeaders,
+		Body:            req.Body,
+		IsBase64Encoded: req.IsBase64Encoded,
 	}
-	url, err := url.Parse(req.Path)
-	if err != nil {
-		return nil, err
-	}
-	body := ioutil.NopCloser(bytes.NewBuffer([]byte(req.Body)))
-
-	return &http.Request{
-		Method:        req.HTTPMethod,
-		URL:           url,
-		Header:        headers,
-		Body:          body,
-		ContentLength: int64(len(req.Body)),
-	}, nil
-}
 
-func (h *Lambda) mapAPIGatewayResponse(resp *httptest.ResponseRecorder) (*events.APIGatewayProxyResponse, error) {
-	headers := make(map[string]string)
-	for k, v := range resp.Header() {
-		headers[k] = strings.Join(v, ";")
+	// Fall back to single value parameters where multi value parameters are not provided
+	if len(inv.Query) == 0 && len(req.QueryStringParameters) > 0 {
+		inv.Query = make(map[string][]string)
+		for k, v := range req.QueryStringParameters {
+			inv.Query[k] = []string{v}
+		}
+	}
+	if len(inv.Headers) == 0 && len(req.Headers) > 0 {
+		inv.Headers = make(map[string][]string)
+		for k, v := range req.Headers {
+			inv.Headers[k] = []string{v}
+		}
 	}
 
-	return &events.APIGatewayProxyResponse{
-		StatusCode:      resp.Code,
-		Headers:         headers,
-		Body:            resp.Body.String(),
-		IsBase64Encoded: false,
-	}, nil
-}
-
-type apiGWResp events.APIGatewayProxyResponse
-
-func (lr *apiGWResp) Header() http.Header {
-	return lr.Header()
+	return inv
 }
 
-func (lr *apiGWResp) Write(body []byte) (int, error) {
-	lr.Body += string(body)
-	return len(body), nil
-}
+// mapAPIGatewayResponse maps a generic invocation response to an API Gateway proxy response
+func mapAPIGatewayResponse(resp *InvocationResponse) events.APIGatewayProxyResponse {
+	headers := make(map[string]string)
+	for k, v := range resp.Headers {
+		headers[k] = strings.Join(v, ",")
+	}
 
-func (lr *apiGWResp) WriteHeader(status int) {
-	lr.StatusCode = status
+	return events.APIGatewayProxyResponse{
+		StatusCode:        resp.StatusCode,
+		Headers:           headers,
+		MultiValueHeaders: resp.Headers,
+		Body:              resp.Body,
+		IsBase64Encoded:   resp.IsBase64Encoded,
+	}
 }
 
 var internalError = events.APIGatewayProxyResponse{
@@ -82,32 +75,24 @@ var internalError = events.APIGatewayProxyResponse{
 }
 
 func (h *Lambda) handle(ctx context.Context, gwReq events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-	logger := h.logger.WithField("request-id", gwReq.RequestContext.RequestID)
+	logger := h.logger.WithField(logging.RequestIDField, gwReq.RequestContext.RequestID)
 
-	req, err := h.mapAPIGatewayRequest(gwReq)
+	resp, err := Invoke(h.handler, mapAPIGatewayRequest(gwReq))
 	if err != nil {
 		logger.Errorf("Mapping api request (%s)", err)
 		return internalError, err
 	}
 
-	resp := &httptest.ResponseRecorder{}
-	h.handler.ServeHTTP(resp, req)
-
-	gwResp, err := h.mapAPIGatewayResponse(resp)
-	if err != nil {
-		logger.Errorf("Mapping api response (%s)", err)
-		return internalError, err
-	}
-
-	return *gwResp, nil
+	return mapAPIGatewayResponse(resp), nil
 }
 
 // Run starts a lambda server instance
 func (h *Lambda) Run() {
+	h.setState(StateRunning)
 	lambda.Start(h.handle)
 }
 
 // Close stub to fulfil interface
 func (h *Lambda) Close() {
-
+	h.setState(StateStopped)
 }
@@ -0,0 +1,258 @@
+package servers
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ryankurte/go-api/lib/options"
+)
+
+// Listen address schemes
+const (
+	SchemeTCP     = "tcp"
+	SchemeUnix    = "unix"
+	SchemeSystemd = "systemd"
+)
+
+// First file descriptor passed by systemd socket activation or graceful restart
+const listenFdsStart = 3
+
+// Environment variables used to hand sockets to a new process on graceful restart
+const (
+	envInheritFds   = "GOAPI_INHERIT_FDS"
+	envInheritNames = "GOAPI_INHERIT_NAMES"
+	envReadyFd      = "GOAPI_READY_FD"
+)
+
+// Listen creates listeners for the configured listen addresses,
+// defaulting to a TCP listener on the bind address and port.
+func Listen(o *options.Base) ([]net.Listener, error) {
+	addresses := o.Listen
+	if len(addresses) == 0 {
+		addresses = []string{net.JoinHostPort(o.BindAddress, o.Port)}
+	}
+
+	mode, err := strconv.ParseUint(o.SocketMode, 8, 32)
+	if o.SocketMode != "" && err != nil {
+		return nil, fmt.Errorf("Invalid socket mode '%s' (%s)", o.SocketMode, err)
+	}
+
+	listeners := make([]net.Listener, 0)
+	for _, a := range addresses {
+		l, err := listenAddress(a, os.FileMode(mode))
+		if err != nil {
+			closeListeners(listeners)
+			return nil, err
+		}
+		listeners = append(listeners, l...)
+	}
+
+	return listeners, nil
+}
+
+func listenAddress(address string, mode os.FileMode) ([]net.Listener, error) {
+	scheme, addr := SchemeTCP, address
+	if i := strings.Index(address, "://"); i >= 0 {
+		scheme, addr = address[:i], address[i+3:]
+	} else if address == SchemeSystemd {
+		scheme = SchemeSystemd
+	}
+
+	switch scheme {
+	case SchemeTCP:
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		return []net.Listener{l}, nil
+	case SchemeUnix:
+		l, err := ListenUnix(addr, mode)
+		if err != nil {
+			return nil, err
+		}
+		return []net.Listener{l}, nil
+	case SchemeSystemd:
+		return SystemdListeners()
+	default:
+		return nil, fmt.Errorf("Unrecognised listen address scheme '%s' in '%s'", scheme, address)
+	}
+}
+
+// ListenUnix creates a unix domain socket listener with the provided file mode,
+// removing any stale socket file at the provided path.
+func ListenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		// Sockets accepting connections belong to a running process
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("Socket '%s' is in use by another process", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("Error removing stale socket '%s' (%s)", path, err)
+		}
+	}
+
+	// The socket mode is set after binding rather than via the umask, as the umask is process-wide.
+	// Where access must be restricted prior to the mode being set, place the socket in a restricted directory.
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if mode != 0 {
+		if err := os.Chmod(path, mode); err != nil {
+			l.Close()
+			return nil, fmt.Errorf("Error setting socket mode (%s)", err)
+		}
+	}
+
+	return l, nil
+}
+
+// SystemdListeners fetches listeners passed via systemd socket activation (LISTEN_FDS)
+func SystemdListeners() ([]net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, fmt.Errorf("No sockets passed by systemd for this process")
+	}
+
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count < 1 {
+		return nil, fmt.Errorf("No sockets passed by systemd (LISTEN_FDS: '%s')", os.Getenv("LISTEN_FDS"))
+	}
+
+	// Sockets are named via LISTEN_FDNAMES where specified
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	// Unset environment so sockets are not inherited by child processes
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	listeners := make([]net.Listener, 0)
+	for i := 0; i < count; i++ {
+		name := fmt.Sprintf("LISTEN_FD_%d", listenFdsStart+i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+
+		f := os.NewFile(uintptr(listenFdsStart+i), name)
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			closeListeners(listeners)
+			return nil, fmt.Errorf("Error using systemd socket '%s' (%s)", name, err)
+		}
+		listeners = append(listeners, l)
+	}
+
+	return listeners, nil
+}
+
+// Sockets handed over by a previous process on graceful restart, by name
+var inherited struct {
+	sync.Mutex
+	files map[string][]*os.File
+}
+
+// InheritedListeners fetches listeners handed over by a previous process on graceful restart
+// under the provided name, returning nil where none are available.
+func InheritedListeners(name string) ([]net.Listener, error) {
+	files := inheritedFiles(name)
+	if len(files) == 0 {
+		return nil, nil
+	}
+	return fileListeners(files)
+}
+
+// inheritedFiles fetches (and releases) sockets handed over under the provided name
+func inheritedFiles(name string) []*os.File {
+	inherited.Lock()
+	defer inherited.Unlock()
+
+	if inherited.files == nil {
+		inherited.files = make(map[string][]*os.File)
+
+		// Sockets are named via GOAPI_INHERIT_NAMES, in the order they are passed
+		count, _ := strconv.Atoi(os.Getenv(envInheritFds))
+		names := strings.Split(os.Getenv(envInheritNames), ":")
+		os.Unsetenv(envInheritFds)
+		os.Unsetenv(envInheritNames)
+
+		for i := 0; i < count && i < len(names); i++ {
+			f := os.NewFile(uintptr(listenFdsStart+i), fmt.Sprintf("inherited-%s-%d", names[i], i))
+			inherited.files[names[i]] = append(inherited.files[names[i]], f)
+		}
+	}
+
+	files := inherited.files[name]
+	delete(inherited.files, name)
+	return files
+}
+
+// fileListeners creates listeners from the provided socket files, closing the files
+func fileListeners(files []*os.File) ([]net.Listener, error) {
+	defer closeFiles(files)
+
+	listeners := make([]net.Listener, 0)
+	for _, f := range files {
+		l, err := net.FileListener(f)
+		if err != nil {
+			closeListeners(listeners)
+			return nil, fmt.Errorf("Error using inherited listener '%s' (%s)", f.Name(), err)
+		}
+		listeners = append(listeners, l)
+	}
+
+	return listeners, nil
+}
+
+// notifyReady notifies a previous process that this process is ready to accept connections
+// following a graceful restart, so the previous process may drain.
+func notifyReady() error {
+	fd, err := strconv.Atoi(os.Getenv(envReadyFd))
+	if err != nil {
+		return nil
+	}
+	os.Unsetenv(envReadyFd)
+
+	f := os.NewFile(uintptr(fd), "ready")
+	defer f.Close()
+
+	_, err = f.Write([]byte{1})
+	return err
+}
+
+func closeListeners(listeners []net.Listener) {
+	for _, l := range listeners {
+		l.Close()
+	}
+}
+
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
+
+// WaitForListener blocks until a TCP listener accepts connections at the provided address,
+// for use where a server is started in the background (ie. in tests)
+func WaitForListener(addr string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Timeout waiting for listener at %s (%s)", addr, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
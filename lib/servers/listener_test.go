@@ -0,0 +1,115 @@
+package servers
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ryankurte/go-api/lib/options"
+)
+
+func TestListen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-api-listen")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "api.sock")
+
+	t.Run("Defaults to bind address", func(t *testing.T) {
+		o := options.Base{BindAddress: "127.0.0.1", Port: "9012"}
+
+		listeners, err := Listen(&o)
+		require.Nil(t, err)
+		defer closeListeners(listeners)
+
+		require.Len(t, listeners, 1)
+		assert.Equal(t, "127.0.0.1:9012", listeners[0].Addr().String())
+	})
+
+	t.Run("Listens on multiple addresses", func(t *testing.T) {
+		o := options.Base{SocketMode: "0600"}
+		o.Listen = []string{"tcp://127.0.0.1:9013", "127.0.0.1:9014", "unix://" + socket}
+
+		listeners, err := Listen(&o)
+		require.Nil(t, err)
+		defer closeListeners(listeners)
+
+		require.Len(t, listeners, 3)
+		assert.Equal(t, "unix", listeners[2].Addr().Network())
+
+		info, err := os.Stat(socket)
+		require.Nil(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	})
+
+	t.Run("Replaces stale sockets only", func(t *testing.T) {
+		path := filepath.Join(dir, "stale.sock")
+
+		l, err := ListenUnix(path, 0600)
+		require.Nil(t, err)
+
+		_, err = ListenUnix(path, 0600)
+		assert.NotNil(t, err, "socket in use")
+
+		l.(*net.UnixListener).SetUnlinkOnClose(false)
+		l.Close()
+
+		l, err = ListenUnix(path, 0600)
+		require.Nil(t, err, "stale socket")
+		l.Close()
+	})
+
+	t.Run("Rejects unknown schemes", func(t *testing.T) {
+		o := options.Base{}
+		o.Listen = []string{"tcp://127.0.0.1:9015", "udp://127.0.0.1:9016"}
+
+		_, err := Listen(&o)
+		assert.NotNil(t, err)
+
+		// Previously created listeners are closed on error
+		l, err := net.Listen("tcp", "127.0.0.1:9015")
+		require.Nil(t, err)
+		l.Close()
+	})
+
+	t.Run("Requires systemd sockets", func(t *testing.T) {
+		o := options.Base{}
+		o.Listen = []string{SchemeSystemd}
+
+		_, err := Listen(&o)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("Serves via unix socket", func(t *testing.T) {
+		o := options.Base{SocketMode: "0660"}
+		o.NoTLS = true
+		o.Listen = []string{"unix://" + socket}
+
+		s := NewHTTP(&o, protoHandler)
+		s.Start()
+		defer s.Close()
+
+		client := http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return net.Dial("unix", socket)
+			},
+		}}
+
+		var resp *http.Response
+		for i := 0; i < 50 && resp == nil; i++ {
+			if resp, err = client.Get("http://unix/"); err != nil {
+				time.Sleep(10 * time.Millisecond)
+			}
+		}
+		require.Nil(t, err)
+		assert.Equal(t, "HTTP/1.1", readBody(t, resp))
+	})
+}
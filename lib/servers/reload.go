@@ -0,0 +1,119 @@
+package servers
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// CertReloader loads a TLS certificate and key pair, reloading them when the files change.
+// Connections in progress continue using the certificate they were established with.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+	logger   log.FieldLogger
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+	hash [sha256.Size]byte
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewCertReloader creates a certificate reloader, loading the initial certificate and key pair
+func NewCertReloader(certFile, keyFile string, logger log.FieldLogger) (*CertReloader, error) {
+	r := CertReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		logger:   logger,
+		done:     make(chan struct{}),
+	}
+
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+// GetCertificate fetches the current certificate, for use in tls.Config
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.cert, nil
+}
+
+// Reload reloads the certificate and key pair if the content of either file has changed.
+// Content is compared rather than modification times so that files replaced by older versions
+// (ie. restored from backup or swapped via symlink) are also detected.
+// The existing certificate is retained if the new pair cannot be loaded.
+func (r *CertReloader) Reload() (bool, error) {
+	certPEM, keyPEM, err := r.read()
+	if err != nil {
+		return false, err
+	}
+	hash := sha256.Sum256(append(append([]byte{}, certPEM...), keyPEM...))
+
+	r.mu.RLock()
+	changed := r.cert == nil || hash != r.hash
+	r.mu.RUnlock()
+	if !changed {
+		return false, nil
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return false, fmt.Errorf("Error loading TLS certificate and key (%s)", err)
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.hash = hash
+	r.mu.Unlock()
+
+	return true, nil
+}
+
+// Watch polls for certificate changes at the provided interval until Close is called
+func (r *CertReloader) Watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			reloaded, err := r.Reload()
+			if err != nil {
+				r.logger.Errorf("TLS certificate reload failed: %s", err)
+			} else if reloaded {
+				r.logger.Infof("Reloaded TLS certificate from %s", r.certFile)
+			}
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// Close stops watching for certificate changes, subsequent calls have no effect
+func (r *CertReloader) Close() {
+	r.closeOnce.Do(func() { close(r.done) })
+}
+
+func (r *CertReloader) read() ([]byte, []byte, error) {
+	certPEM, err := ioutil.ReadFile(r.certFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error reading TLS certificate (%s)", err)
+	}
+	keyPEM, err := ioutil.ReadFile(r.keyFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error reading TLS key (%s)", err)
+	}
+	return certPEM, keyPEM, nil
+}
@@ -0,0 +1,181 @@
+//go:build !windows
+// +build !windows
+
+package servers
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Timeout for a new process to become ready on graceful restart
+var RestartTimeout = 30 * time.Second
+
+// Socket with an underlying file descriptor
+type fileSocket interface {
+	File() (*os.File, error)
+}
+
+// Socket handed to a new process on graceful restart
+type handoverSocket struct {
+	name   string
+	socket interface{}
+}
+
+// Restart starts a new instance of the current process, handing over the sockets of all servers
+// running in this process, then drains these servers via Close once the new process reports it is ready.
+func (s *HTTP) Restart() error {
+	s.setState(StateRestarting)
+
+	servers := runningServers()
+	err := s.handover(servers)
+	if err != nil {
+		s.logger.Errorf("Graceful restart failed: %s", err)
+		s.setState(StateRunning)
+		return err
+	}
+
+	// Drain this server prior to others (ie. admin) so readiness reports failure while draining
+	s.Close()
+	for _, r := range servers {
+		r.Close()
+	}
+
+	return nil
+}
+
+// sockets fetches the sockets to be handed over on graceful restart
+func (s *HTTP) sockets() []handoverSocket {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sockets := make([]handoverSocket, 0)
+	for _, l := range s.listeners {
+		sockets = append(sockets, handoverSocket{s.name, l})
+	}
+	if s.quicConn != nil {
+		sockets = append(sockets, handoverSocket{s.name + socketQUIC, s.quicConn})
+	}
+	if s.challengeListener != nil {
+		sockets = append(sockets, handoverSocket{s.name + socketChallenge, s.challengeListener})
+	}
+	return sockets
+}
+
+func (s *HTTP) handover(servers []*HTTP) error {
+	files := make([]*os.File, 0)
+	defer func() {
+		closeFiles(files)
+	}()
+
+	// Socket files must remain for the new process when this process drains,
+	// restored if the handover fails so sockets are removed on exit
+	unlink := make([]*net.UnixListener, 0)
+	success := false
+	defer func() {
+		for _, ul := range unlink {
+			ul.SetUnlinkOnClose(!success)
+		}
+	}()
+
+	names := make([]string, 0)
+	for _, r := range servers {
+		for _, hs := range r.sockets() {
+			fs, ok := hs.socket.(fileSocket)
+			if !ok {
+				return fmt.Errorf("Socket %s does not support handover", hs.name)
+			}
+			if ul, ok := hs.socket.(*net.UnixListener); ok {
+				ul.SetUnlinkOnClose(false)
+				unlink = append(unlink, ul)
+			}
+			f, err := fs.File()
+			if err != nil {
+				return err
+			}
+			files = append(files, f)
+			names = append(names, hs.name)
+		}
+	}
+
+	// Pipe over which the new process signals readiness
+	ready, notify, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer ready.Close()
+	files = append(files, notify)
+
+	path, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(path, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.ExtraFiles = files
+	cmd.Env = append(os.Environ(),
+		fmt.Sprintf("%s=%d", envInheritFds, len(names)),
+		fmt.Sprintf("%s=%s", envInheritNames, strings.Join(names, ":")),
+		fmt.Sprintf("%s=%d", envReadyFd, listenFdsStart+len(names)),
+	)
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	notify.Close()
+	files = files[:len(files)-1]
+
+	s.logger.Infof("Started new process (pid: %d), waiting for ready", cmd.Process.Pid)
+
+	// Wait for the new process to report ready (or exit)
+	result := make(chan error, 1)
+	go func() {
+		b := make([]byte, 1)
+		_, err := ready.Read(b)
+		result <- err
+	}()
+
+	select {
+	case err := <-result:
+		if err != nil {
+			cmd.Process.Kill()
+			return fmt.Errorf("New process exited before ready (%s)", err)
+		}
+	case <-time.After(RestartTimeout):
+		cmd.Process.Kill()
+		return fmt.Errorf("Timeout waiting for new process")
+	}
+
+	s.logger.Infof("New process (pid: %d) ready, draining", cmd.Process.Pid)
+
+	success = true
+	return cmd.Process.Release()
+}
+
+// watchRestart triggers a graceful restart on SIGHUP or SIGUSR2 until the server exits
+func (s *HTTP) watchRestart() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGUSR2)
+
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case sig := <-signals:
+				s.logger.Infof("Received %s, starting graceful restart", sig)
+				if s.Restart() == nil {
+					return
+				}
+			case <-s.done:
+				return
+			}
+		}
+	}()
+}
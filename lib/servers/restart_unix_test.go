@@ -0,0 +1,116 @@
+//go:build !windows
+// +build !windows
+
+package servers
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ryankurte/go-api/lib/options"
+)
+
+func TestListenerHandover(t *testing.T) {
+	// Run as the new process, serving on inherited listeners
+	if os.Getenv(envInheritFds) != "" {
+		o := options.Base{}
+		o.NoTLS = true
+		o.GracefulRestart = true
+		NewHTTP(&o, protoHandler).Run()
+		return
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:9017")
+	require.Nil(t, err)
+	f, err := l.(*net.TCPListener).File()
+	require.Nil(t, err)
+
+	ready, notify, err := os.Pipe()
+	require.Nil(t, err)
+
+	cmd := exec.Command(os.Args[0], "-test.run=TestListenerHandover")
+	cmd.ExtraFiles = []*os.File{f, notify}
+	cmd.Env = append(os.Environ(),
+		fmt.Sprintf("%s=%d", envInheritFds, 1),
+		fmt.Sprintf("%s=%s", envInheritNames, options.ModeHTTP),
+		fmt.Sprintf("%s=%d", envReadyFd, listenFdsStart+1),
+	)
+	require.Nil(t, cmd.Start())
+	defer cmd.Process.Kill()
+
+	// Release listener in this process
+	notify.Close()
+	f.Close()
+	l.Close()
+
+	t.Run("New process reports ready", func(t *testing.T) {
+		b := make([]byte, 1)
+		_, err := ready.Read(b)
+		require.Nil(t, err)
+	})
+
+	t.Run("New process serves on inherited listener", func(t *testing.T) {
+		resp, err := http.Get("http://127.0.0.1:9017/")
+		require.Nil(t, err)
+		assert.Equal(t, "HTTP/1.1", readBody(t, resp))
+	})
+}
+
+// Handler responding with the serving process ID
+var pidHandler = http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+	rw.Write([]byte(strconv.Itoa(os.Getpid())))
+})
+
+func TestRestart(t *testing.T) {
+	o := options.Base{}
+	o.NoTLS = true
+	o.GracefulRestart = true
+	o.Listen = []string{"127.0.0.1:0"}
+	o.Admin.Address = "127.0.0.1:0"
+
+	// Run as the new process, serving on inherited sockets for long enough to test
+	if os.Getenv(envInheritFds) != "" {
+		time.AfterFunc(2*time.Second, func() { os.Exit(0) })
+		go NewAdmin(&o, pidHandler).Run()
+		NewHTTP(&o, pidHandler).Run()
+		return
+	}
+
+	s, admin := NewHTTP(&o, pidHandler), NewAdmin(&o, pidHandler)
+	admin.Start()
+	s.Start()
+	defer admin.Close()
+	defer s.Close()
+	addr, adminAddr := serverAddress(t, s), serverAddress(t, admin)
+
+	// Restart into this test only
+	args := os.Args
+	os.Args = []string{args[0], "-test.run=^TestRestart$"}
+	defer func() { os.Args = args }()
+
+	require.Nil(t, s.Restart())
+	assert.Equal(t, StateStopped, s.State())
+	assert.Equal(t, StateStopped, admin.State())
+
+	t.Run("Close after restart has no effect", func(t *testing.T) {
+		s.Close()
+		admin.Close()
+	})
+
+	t.Run("New process serves on handed over sockets", func(t *testing.T) {
+		for _, a := range []string{addr, adminAddr} {
+			resp, err := http.Get("http://" + a + "/")
+			require.Nil(t, err)
+			assert.NotEqual(t, strconv.Itoa(os.Getpid()), readBody(t, resp))
+		}
+	})
+}
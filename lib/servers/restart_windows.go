@@ -0,0 +1,15 @@
+package servers
+
+import (
+	"fmt"
+)
+
+// Restart is not supported on windows
+func (s *HTTP) Restart() error {
+	return fmt.Errorf("Graceful restart is not supported on this platform")
+}
+
+// watchRestart is not supported on windows
+func (s *HTTP) watchRestart() {
+	s.logger.Warn("Graceful restart is not supported on this platform")
+}
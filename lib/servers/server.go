@@ -2,11 +2,18 @@ package servers
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	gcontext "github.com/gorilla/context"
+	"github.com/quic-go/quic-go/http3"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 
 	"github.com/ryankurte/go-api/lib/options"
 )
@@ -14,49 +21,310 @@ import (
 // HTTP is an HTTP server based http handler
 type HTTP struct {
 	Base
-	server http.Server
+	// Guards components created while starting (servers, sockets, reloader) for Close and Restart
+	mu        sync.Mutex
+	server    *http.Server
+	challenge *http.Server
+	reloader  *CertReloader
+	// Serve without TLS regardless of TLS options
+	cleartext bool
+	// Serve HTTP/2 over cleartext (h2c mode)
+	h2c bool
+	// HTTP/3 server (http3 mode)
+	quic *http3.Server
+	// Active sockets (for handover on graceful restart)
+	listeners         []net.Listener
+	quicConn          net.PacketConn
+	challengeListener net.Listener
+	done              chan struct{}
+	closeOnce         sync.Once
 }
 
 // NewHTTP creates a new HTTP server with the provided options
 func NewHTTP(o *options.Base, h http.Handler) *HTTP {
 	return &HTTP{
 		Base: NewBase(options.ModeHTTP, h, o),
+		done: make(chan struct{}),
 	}
 }
 
 // Run starts a server instance (this only returns on error or exit)
 func (s *HTTP) Run() {
-	var err error
+	if s.quic != nil && (s.options.NoTLS || s.cleartext) {
+		s.logger.Error("HTTP/3 requires TLS, remove --tls.disable or use http or h2c mode")
+		return
+	}
 
-	contextHandler := gcontext.ClearHandler(s.handler)
+	var handler http.Handler = gcontext.ClearHandler(s.handler)
 	bindAddress := fmt.Sprintf("%s:%s", s.options.BindAddress, s.options.Port)
 
-	s.server = http.Server{Addr: bindAddress, Handler: contextHandler}
+	if s.h2c {
+		handler = h2c.NewHandler(handler, &http2.Server{})
+	}
+
+	server := &http.Server{
+		Addr:              bindAddress,
+		Handler:           handler,
+		ReadTimeout:       s.options.ReadTimeout,
+		ReadHeaderTimeout: s.options.ReadHeaderTimeout,
+		WriteTimeout:      s.options.WriteTimeout,
+		IdleTimeout:       s.options.IdleTimeout,
+		MaxHeaderBytes:    s.options.MaxHeaderBytes,
+	}
+
+	listeners, err := s.listen()
+	if err != nil {
+		s.logger.Errorf("Listen error: %s", err)
+		return
+	}
+	s.mu.Lock()
+	s.server, s.listeners = server, listeners
+	s.mu.Unlock()
+	register(s)
+
+	if s.options.GracefulRestart {
+		s.watchRestart()
+	}
 
-	s.logger.Infof("Starting http server at %s (bind: %s)", s.options.ExternalAddress, bindAddress)
+	s.logger.Infof("Starting http server at %s (bind: %s)", s.options.ExternalAddress, listenerAddresses(listeners))
 
-	if s.options.NoTLS {
+	if s.options.NoTLS || s.cleartext {
 		s.logger.Warn("TLS IS DISABLED. USE EXTERNAL TLS TERMINATION.")
-		err = s.server.ListenAndServe()
+		err = s.serve(listeners, false)
+	} else if s.options.ACME.Enabled {
+		s.logger.Infof("Starting http server with ACME (directory: %s)", s.options.ACME.DirectoryURL)
+		err = s.runTLS(listeners, s.acmeTLSConfig)
 	} else if s.options.TLSCert != "" && s.options.TLSKey != "" {
 		s.logger.Info("Starting http server with TLS")
-		err = s.server.ListenAndServeTLS(s.options.TLSCert, s.options.TLSKey)
+		err = s.runTLS(listeners, s.certTLSConfig)
 	} else {
+		closeListeners(listeners)
 		s.logger.Error("TLS enabled but missing certificate or key argument")
 	}
 
-	if err != nil {
+	if err != nil && err != http.ErrServerClosed {
 		s.logger.Errorf("ListenAndServe error: %s", err)
 	}
 }
 
+// serve serves on each of the provided listeners, returning once all have exited
+func (s *HTTP) serve(listeners []net.Listener, useTLS bool) error {
+	errs := make(chan error, len(listeners))
+	for _, l := range listeners {
+		go func(l net.Listener) {
+			if useTLS {
+				errs <- s.server.ServeTLS(l, "", "")
+			} else {
+				errs <- s.server.Serve(l)
+			}
+		}(l)
+	}
+
+	s.setState(StateRunning)
+	if s.options.GracefulRestart {
+		if err := notifyReady(); err != nil {
+			s.logger.Errorf("Error notifying previous process of readiness: %s", err)
+		}
+	}
+
+	var err error
+	for range listeners {
+		if e := <-errs; e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func (s *HTTP) runTLS(listeners []net.Listener, build func() (*tls.Config, error)) error {
+	c, err := build()
+	if err == nil {
+		err = ConfigureTLS(c, s.options)
+	}
+	if err == nil {
+		err = ConfigureClientAuth(c, s.options)
+	}
+	if err != nil {
+		closeListeners(listeners)
+		return err
+	}
+	s.server.TLSConfig = c
+
+	// Start HTTP/3 server alongside TLS server if enabled
+	if s.quic != nil {
+		s.quic.Addr = s.server.Addr
+		s.quic.IdleTimeout = s.options.IdleTimeout
+		s.quic.MaxHeaderBytes = s.options.MaxHeaderBytes
+		s.quic.TLSConfig = http3.ConfigureTLSConfig(c.Clone())
+
+		conn, err := s.listenPacket(s.quic.Addr)
+		if err != nil {
+			s.logger.Errorf("HTTP/3 listen error: %s", err)
+		} else {
+			s.mu.Lock()
+			s.quicConn = conn
+			s.mu.Unlock()
+			go func() {
+				s.logger.Infof("Starting http3 server (bind: udp/%s)", conn.LocalAddr())
+				if err := s.quic.Serve(conn); err != nil && err != http.ErrServerClosed {
+					s.logger.Errorf("HTTP/3 Serve error: %s", err)
+				}
+			}()
+		}
+	}
+
+	return s.serve(listeners, true)
+}
+
+func (s *HTTP) certTLSConfig() (*tls.Config, error) {
+	r, err := NewCertReloader(s.options.TLSCert, s.options.TLSKey, s.logger)
+	if err != nil {
+		return nil, err
+	}
+	if s.options.TLS.ReloadInterval > 0 {
+		s.mu.Lock()
+		s.reloader = r
+		s.mu.Unlock()
+		go r.Watch(s.options.TLS.ReloadInterval)
+	}
+
+	return &tls.Config{GetCertificate: r.GetCertificate}, nil
+}
+
+func (s *HTTP) acmeTLSConfig() (*tls.Config, error) {
+	m, err := NewACMEManager(s.options)
+	if err != nil {
+		return nil, err
+	}
+
+	// Start HTTP-01 challenge listener if enabled
+	if s.options.ACME.HTTPAddress != "" {
+		challenge := &http.Server{Addr: s.options.ACME.HTTPAddress, Handler: m.HTTPHandler(nil)}
+
+		l, err := s.listenChallenge(s.options.ACME.HTTPAddress)
+		if err != nil {
+			s.logger.Errorf("ACME challenge listener error: %s", err)
+		} else {
+			s.mu.Lock()
+			s.challenge, s.challengeListener = challenge, l
+			s.mu.Unlock()
+			go func() {
+				s.logger.Infof("Starting ACME HTTP-01 challenge listener (bind: %s)", l.Addr())
+				if err := challenge.Serve(l); err != nil && err != http.ErrServerClosed {
+					s.logger.Errorf("ACME challenge listener error: %s", err)
+				}
+			}()
+		}
+	}
+
+	// TLS-ALPN-01 challenges are handled via the manager TLS configuration
+	return m.TLSConfig(), nil
+}
+
+// Suffixes naming additional sockets handed over on graceful restart
+const (
+	socketQUIC      = "-quic"
+	socketChallenge = "-acme"
+)
+
+// listen creates listeners, using those handed over by a previous process where available
+func (s *HTTP) listen() ([]net.Listener, error) {
+	if listeners, err := InheritedListeners(s.name); listeners != nil || err != nil {
+		return listeners, err
+	}
+	return Listen(s.options)
+}
+
+// listenPacket creates the HTTP/3 UDP socket, using one handed over by a previous process where available
+func (s *HTTP) listenPacket(addr string) (net.PacketConn, error) {
+	if files := inheritedFiles(s.name + socketQUIC); len(files) > 0 {
+		defer closeFiles(files)
+		return net.FilePacketConn(files[0])
+	}
+	return net.ListenPacket("udp", addr)
+}
+
+// listenChallenge creates the ACME challenge listener, using one handed over by a previous process where available
+func (s *HTTP) listenChallenge(addr string) (net.Listener, error) {
+	if files := inheritedFiles(s.name + socketChallenge); len(files) > 0 {
+		defer closeFiles(files)
+		return net.FileListener(files[0])
+	}
+	return net.Listen("tcp", addr)
+}
+
+func listenerAddresses(listeners []net.Listener) string {
+	addresses := make([]string, len(listeners))
+	for i, l := range listeners {
+		addresses[i] = fmt.Sprintf("%s://%s", l.Addr().Network(), l.Addr())
+	}
+	return strings.Join(addresses, ", ")
+}
+
 func (s *HTTP) Start() {
 	go s.Run()
 }
 
-// Close exits a server instance
+// Close exits a server instance, subsequent calls have no effect
 func (s *HTTP) Close() {
+	s.closeOnce.Do(s.close)
+}
+
+func (s *HTTP) close() {
+	s.setState(StateDraining)
+	unregister(s)
+
+	s.mu.Lock()
+	server, challenge, reloader, quicConn := s.server, s.challenge, s.reloader, s.quicConn
+	s.mu.Unlock()
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	s.server.Shutdown(ctx)
+	if server != nil {
+		server.Shutdown(ctx)
+	}
+	if challenge != nil {
+		challenge.Shutdown(ctx)
+	}
+	if s.quic != nil {
+		s.quic.Shutdown(ctx)
+	}
+	if quicConn != nil {
+		quicConn.Close()
+	}
+	if reloader != nil {
+		reloader.Close()
+	}
 	cancel()
+
+	close(s.done)
+	s.setState(StateStopped)
+}
+
+// Servers running in this process, handed over together on graceful restart
+var running struct {
+	sync.Mutex
+	servers []*HTTP
+}
+
+func register(s *HTTP) {
+	running.Lock()
+	defer running.Unlock()
+	running.servers = append(running.servers, s)
+}
+
+func unregister(s *HTTP) {
+	running.Lock()
+	defer running.Unlock()
+	for i, r := range running.servers {
+		if r == s {
+			running.servers = append(running.servers[:i], running.servers[i+1:]...)
+			return
+		}
+	}
+}
+
+func runningServers() []*HTTP {
+	running.Lock()
+	defer running.Unlock()
+	return append([]*HTTP{}, running.servers...)
 }
@@ -0,0 +1,137 @@
+package servers
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+
+	"github.com/ryankurte/go-api/lib/options"
+)
+
+// Handler responding with the request protocol
+var protoHandler = http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+	rw.Write([]byte(req.Proto))
+})
+
+// serverAddress blocks until the provided server is running, returning the address of its first listener
+func serverAddress(t *testing.T, s *HTTP) string {
+	for i := 0; i < 100 && s.State() != StateRunning; i++ {
+		time.Sleep(50 * time.Millisecond)
+	}
+	require.Equal(t, StateRunning, s.State())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.listeners[0].Addr().String()
+}
+
+func readBody(t *testing.T, resp *http.Response) string {
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.Nil(t, err)
+	return string(body)
+}
+
+func TestH2C(t *testing.T) {
+	o := options.Base{BindAddress: "127.0.0.1", Port: "9010"}
+
+	s := NewH2C(&o, protoHandler)
+	s.Start()
+	defer s.Close()
+	require.Nil(t, WaitForListener("127.0.0.1:9010", time.Second))
+
+	t.Run("Serves HTTP/2 with prior knowledge", func(t *testing.T) {
+		client := http.Client{Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+				return net.Dial(network, addr)
+			},
+		}}
+
+		resp, err := client.Get("http://127.0.0.1:9010/")
+		require.Nil(t, err)
+		assert.Equal(t, "HTTP/2.0", readBody(t, resp))
+	})
+
+	t.Run("Serves HTTP/1.1", func(t *testing.T) {
+		resp, err := http.Get("http://127.0.0.1:9010/")
+		require.Nil(t, err)
+		assert.Equal(t, "HTTP/1.1", readBody(t, resp))
+	})
+}
+
+func TestHTTP3(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-api-http3")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	cert, key := generateCert(t, "localhost", []string{"localhost"}, nil, nil)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.Nil(t, err)
+
+	o := options.Base{BindAddress: "127.0.0.1", Port: "9011"}
+	o.TLSCert, o.TLSKey = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	require.Nil(t, ioutil.WriteFile(o.TLSCert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0600))
+	require.Nil(t, ioutil.WriteFile(o.TLSKey, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+
+	s := NewHTTP3(&o, protoHandler)
+	s.Start()
+	defer s.Close()
+	require.Nil(t, WaitForListener("127.0.0.1:9011", time.Second))
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	tlsConfig := tls.Config{RootCAs: pool, ServerName: "localhost"}
+
+	t.Run("Advertises HTTP/3 via TLS", func(t *testing.T) {
+		client := http.Client{Transport: &http.Transport{TLSClientConfig: &tlsConfig}}
+
+		resp, err := client.Get("https://127.0.0.1:9011/")
+		require.Nil(t, err)
+		assert.Equal(t, "HTTP/1.1", readBody(t, resp))
+		assert.Contains(t, resp.Header.Get("Alt-Svc"), `h3=":9011"`)
+	})
+
+	t.Run("Serves HTTP/3", func(t *testing.T) {
+		transport := http3.Transport{TLSClientConfig: &tlsConfig}
+		defer transport.Close()
+		client := http.Client{Transport: &transport, Timeout: 5 * time.Second}
+
+		resp, err := client.Get("https://127.0.0.1:9011/")
+		require.Nil(t, err)
+		assert.Equal(t, "HTTP/3.0", readBody(t, resp))
+	})
+}
+
+func TestHTTP3RequiresTLS(t *testing.T) {
+	o := options.Base{BindAddress: "127.0.0.1", Port: "0"}
+	o.NoTLS = true
+
+	s := NewHTTP3(&o, protoHandler)
+	done := make(chan struct{})
+	go func() {
+		s.Run()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		s.Close()
+		t.Fatal("HTTP/3 server started without TLS")
+	}
+	assert.Equal(t, StateStarting, s.State())
+}
@@ -0,0 +1,145 @@
+package servers
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/ryankurte/go-api/lib/options"
+	"github.com/ryankurte/go-api/lib/security"
+)
+
+// Client certificate mode mapping
+var clientAuthModes = map[string]tls.ClientAuthType{
+	"":                              tls.NoClientCert,
+	options.ClientAuthNone:          tls.NoClientCert,
+	options.ClientAuthRequest:       tls.RequestClientCert,
+	options.ClientAuthRequire:       tls.RequireAnyClientCert,
+	options.ClientAuthVerifyIfGiven: tls.VerifyClientCertIfGiven,
+	options.ClientAuthVerify:        tls.RequireAndVerifyClientCert,
+}
+
+// TLS version mapping
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Curve mapping
+var tlsCurves = map[string]tls.CurveID{
+	"X25519": tls.X25519,
+	"P256":   tls.CurveP256,
+	"P384":   tls.CurveP384,
+	"P521":   tls.CurveP521,
+}
+
+// DefaultCipherSuites are the TLS 1.0-1.2 cipher suites used if none are specified
+var DefaultCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+}
+
+// DefaultCurvePreferences are the elliptic curves used if none are specified
+var DefaultCurvePreferences = []tls.CurveID{tls.X25519, tls.CurveP256}
+
+// ConfigureTLS applies TLS version, cipher suite and curve options to the provided TLS configuration
+func ConfigureTLS(c *tls.Config, o *options.Base) error {
+	c.MinVersion = tls.VersionTLS12
+	if o.TLS.MinVersion != "" {
+		v, ok := tlsVersions[o.TLS.MinVersion]
+		if !ok {
+			return fmt.Errorf("Unrecognised TLS version: '%s'", o.TLS.MinVersion)
+		}
+		c.MinVersion = v
+	}
+
+	c.CipherSuites = DefaultCipherSuites
+	if len(o.TLS.CipherSuites) > 0 {
+		suites := make(map[string]uint16)
+		for _, s := range tls.CipherSuites() {
+			suites[s.Name] = s.ID
+		}
+		c.CipherSuites = make([]uint16, len(o.TLS.CipherSuites))
+		for i, name := range o.TLS.CipherSuites {
+			id, ok := suites[name]
+			if !ok {
+				return fmt.Errorf("Unrecognised or insecure cipher suite: '%s'", name)
+			}
+			c.CipherSuites[i] = id
+		}
+	}
+
+	c.CurvePreferences = DefaultCurvePreferences
+	if len(o.TLS.CurvePreferences) > 0 {
+		c.CurvePreferences = make([]tls.CurveID, len(o.TLS.CurvePreferences))
+		for i, name := range o.TLS.CurvePreferences {
+			id, ok := tlsCurves[name]
+			if !ok {
+				return fmt.Errorf("Unrecognised curve: '%s'", name)
+			}
+			c.CurvePreferences[i] = id
+		}
+	}
+
+	return nil
+}
+
+// ConfigureClientAuth applies client certificate (mutual TLS) options to the provided TLS configuration
+func ConfigureClientAuth(c *tls.Config, o *options.Base) error {
+	mode, ok := clientAuthModes[o.TLS.ClientAuth]
+	if !ok {
+		return fmt.Errorf("Unrecognised client auth mode: '%s'", o.TLS.ClientAuth)
+	}
+	c.ClientAuth = mode
+
+	// Allowed identities are only checked against verified certificates
+	subjects, sans := o.TLS.AllowedSubjects, o.TLS.AllowedSANs
+	verify := mode == tls.VerifyClientCertIfGiven || mode == tls.RequireAndVerifyClientCert
+	if (len(subjects) > 0 || len(sans) > 0) && !verify {
+		return fmt.Errorf("Allowed client subjects and SANs require a verifying client auth mode (verify or verify-if-given, mode: %s)", o.TLS.ClientAuth)
+	}
+
+	if mode == tls.NoClientCert {
+		return nil
+	}
+
+	// Load client CA bundles
+	if len(o.TLS.ClientCAs) > 0 {
+		pool := x509.NewCertPool()
+		for _, f := range o.TLS.ClientCAs {
+			pem, err := ioutil.ReadFile(f)
+			if err != nil {
+				return fmt.Errorf("Error reading client CA file (%s)", err)
+			}
+			if ok := pool.AppendCertsFromPEM(pem); !ok {
+				return fmt.Errorf("No certificates found in client CA file '%s'", f)
+			}
+		}
+		c.ClientCAs = pool
+	} else if verify {
+		return fmt.Errorf("Client certificate verification requires a client CA")
+	}
+
+	// Check verified identities against allowed patterns
+	if len(subjects) > 0 || len(sans) > 0 {
+		c.VerifyPeerCertificate = func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+			if len(verifiedChains) == 0 || len(verifiedChains[0]) == 0 {
+				return nil
+			}
+			p := security.NewPeerIdentity(verifiedChains[0][0])
+			if !p.Matches(subjects, sans) {
+				return fmt.Errorf("Client certificate '%s' not allowed", p.Subject)
+			}
+			return nil
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,228 @@
+package servers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ryankurte/go-api/lib/options"
+)
+
+func generateCert(t *testing.T, cn string, dnsNames []string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		DNSNames:              dnsNames,
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  parent == nil,
+	}
+	if parent == nil {
+		parent, parentKey = &template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, parent, &key.PublicKey, parentKey)
+	require.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.Nil(t, err)
+
+	return cert, key
+}
+
+func TestClientAuth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-api-tls")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ca, caKey := generateCert(t, "Test CA", nil, nil, nil)
+	caFile := filepath.Join(dir, "ca.pem")
+	err = ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw}), 0600)
+	require.Nil(t, err)
+
+	client, _ := generateCert(t, "client", []string{"svc.internal.example.com"}, ca, caKey)
+
+	t.Run("Maps client auth modes", func(t *testing.T) {
+		o := options.Base{}
+		o.TLS.ClientCAs = []string{caFile}
+		o.TLS.ClientAuth = options.ClientAuthVerify
+
+		c := tls.Config{}
+		require.Nil(t, ConfigureClientAuth(&c, &o))
+		assert.Equal(t, tls.RequireAndVerifyClientCert, c.ClientAuth)
+		assert.NotNil(t, c.ClientCAs)
+		assert.Nil(t, c.VerifyPeerCertificate)
+	})
+
+	t.Run("Verification requires a client CA", func(t *testing.T) {
+		o := options.Base{}
+		o.TLS.ClientAuth = options.ClientAuthVerify
+
+		c := tls.Config{}
+		assert.NotNil(t, ConfigureClientAuth(&c, &o))
+	})
+
+	t.Run("Checks allowed SAN patterns", func(t *testing.T) {
+		o := options.Base{}
+		o.TLS.ClientCAs = []string{caFile}
+		o.TLS.ClientAuth = options.ClientAuthVerify
+		o.TLS.AllowedSANs = []string{"*.internal.example.com"}
+
+		c := tls.Config{}
+		require.Nil(t, ConfigureClientAuth(&c, &o))
+		require.NotNil(t, c.VerifyPeerCertificate)
+		assert.Nil(t, c.VerifyPeerCertificate(nil, [][]*x509.Certificate{{client, ca}}))
+
+		o.TLS.AllowedSANs = []string{"*.external.example.com"}
+		require.Nil(t, ConfigureClientAuth(&c, &o))
+		assert.NotNil(t, c.VerifyPeerCertificate(nil, [][]*x509.Certificate{{client, ca}}))
+	})
+
+	t.Run("Checks allowed subject patterns", func(t *testing.T) {
+		o := options.Base{}
+		o.TLS.ClientCAs = []string{caFile}
+		o.TLS.ClientAuth = options.ClientAuthVerify
+		o.TLS.AllowedSubjects = []string{"client"}
+
+		c := tls.Config{}
+		require.Nil(t, ConfigureClientAuth(&c, &o))
+		assert.Nil(t, c.VerifyPeerCertificate(nil, [][]*x509.Certificate{{client, ca}}))
+	})
+
+	t.Run("Allowed patterns require a verifying mode", func(t *testing.T) {
+		for _, mode := range []string{options.ClientAuthNone, options.ClientAuthRequest, options.ClientAuthRequire} {
+			o := options.Base{}
+			o.TLS.ClientCAs = []string{caFile}
+			o.TLS.ClientAuth = mode
+			o.TLS.AllowedSubjects = []string{"client"}
+
+			c := tls.Config{}
+			assert.NotNil(t, ConfigureClientAuth(&c, &o), mode)
+		}
+	})
+}
+
+func TestConfigureTLS(t *testing.T) {
+
+	t.Run("Applies hardened defaults", func(t *testing.T) {
+		o := options.Base{}
+
+		c := tls.Config{}
+		require.Nil(t, ConfigureTLS(&c, &o))
+		assert.EqualValues(t, tls.VersionTLS12, c.MinVersion)
+		assert.Equal(t, DefaultCipherSuites, c.CipherSuites)
+		assert.Equal(t, DefaultCurvePreferences, c.CurvePreferences)
+	})
+
+	t.Run("Maps versions, cipher suites and curves", func(t *testing.T) {
+		o := options.Base{}
+		o.TLS.MinVersion = "1.3"
+		o.TLS.CipherSuites = []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}
+		o.TLS.CurvePreferences = []string{"P384"}
+
+		c := tls.Config{}
+		require.Nil(t, ConfigureTLS(&c, &o))
+		assert.EqualValues(t, tls.VersionTLS13, c.MinVersion)
+		assert.Equal(t, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}, c.CipherSuites)
+		assert.Equal(t, []tls.CurveID{tls.CurveP384}, c.CurvePreferences)
+	})
+
+	t.Run("Rejects insecure cipher suites", func(t *testing.T) {
+		o := options.Base{}
+		o.TLS.CipherSuites = []string{"TLS_RSA_WITH_RC4_128_SHA"}
+
+		c := tls.Config{}
+		assert.NotNil(t, ConfigureTLS(&c, &o))
+	})
+}
+
+func TestCertReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-api-reload")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writePair := func(cn string, modTime time.Time) {
+		cert, key := generateCert(t, cn, []string{cn}, nil, nil)
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		require.Nil(t, err)
+		require.Nil(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0600))
+		require.Nil(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+		require.Nil(t, os.Chtimes(certFile, modTime, modTime))
+		require.Nil(t, os.Chtimes(keyFile, modTime, modTime))
+	}
+
+	getName := func(r *CertReloader) string {
+		c, err := r.GetCertificate(nil)
+		require.Nil(t, err)
+		leaf, err := x509.ParseCertificate(c.Certificate[0])
+		require.Nil(t, err)
+		return leaf.Subject.CommonName
+	}
+
+	now := time.Now()
+	writePair("first.example.com", now.Add(-time.Minute))
+
+	r, err := NewCertReloader(certFile, keyFile, log.New())
+	require.Nil(t, err)
+	assert.Equal(t, "first.example.com", getName(r))
+
+	t.Run("Ignores unchanged files", func(t *testing.T) {
+		reloaded, err := r.Reload()
+		require.Nil(t, err)
+		assert.False(t, reloaded)
+	})
+
+	t.Run("Reloads changed files", func(t *testing.T) {
+		writePair("second.example.com", now)
+
+		reloaded, err := r.Reload()
+		require.Nil(t, err)
+		assert.True(t, reloaded)
+		assert.Equal(t, "second.example.com", getName(r))
+	})
+
+	t.Run("Retains certificate on invalid files", func(t *testing.T) {
+		require.Nil(t, ioutil.WriteFile(keyFile, []byte("invalid"), 0600))
+		later := now.Add(time.Minute)
+		require.Nil(t, os.Chtimes(keyFile, later, later))
+
+		_, err := r.Reload()
+		assert.NotNil(t, err)
+		assert.Equal(t, "second.example.com", getName(r))
+	})
+
+	t.Run("Reloads files replaced with older versions", func(t *testing.T) {
+		writePair("third.example.com", now.Add(-time.Hour))
+
+		reloaded, err := r.Reload()
+		require.Nil(t, err)
+		assert.True(t, reloaded)
+		assert.Equal(t, "third.example.com", getName(r))
+	})
+
+	t.Run("Close may be called repeatedly", func(t *testing.T) {
+		go r.Watch(time.Second)
+		r.Close()
+		r.Close()
+	})
+}
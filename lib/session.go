@@ -0,0 +1,77 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+)
+
+// Session value key for typed session data
+const sessionDataKey = "data"
+
+// RegisterSession registers a typed session, stored in the named session, for injection into handlers.
+// Handlers may then accept a pointer to the session type (ie. *AppSession) as a parameter,
+// with modifications saved to the session after the handler returns without error.
+// Session types are serialised as JSON, so only exported fields are stored.
+func (api *API) RegisterSession(name string, session interface{}) error {
+	t := reflect.TypeOf(session)
+	if t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return fmt.Errorf("Session type must be a struct not '%v'", t)
+	}
+
+	empty, err := json.Marshal(reflect.New(t).Interface())
+	if err != nil {
+		return err
+	}
+
+	logger := api.logger.WithField("session", name)
+
+	// Injectors are scoped to this API instance, as they are bound to its session store
+	if err := api.injectors.Register(reflect.PtrTo(t), func(req *http.Request) (interface{}, error) {
+		// Sessions that fail to decode (ie. following secret rotation) are replaced
+		s, err := api.sessionStore.Get(req, name)
+		if err != nil {
+			logger.Debugf("Error loading session, creating new session (%s)", err)
+		}
+
+		v := reflect.New(t)
+		if data, ok := s.Values[sessionDataKey].(string); ok {
+			if err := json.Unmarshal([]byte(data), v.Interface()); err != nil {
+				logger.Debugf("Error decoding session, creating new session (%s)", err)
+				v = reflect.New(t)
+			}
+		}
+
+		return v.Interface(), nil
+	}); err != nil {
+		return err
+	}
+
+	if err := api.injectors.RegisterFinalizer(reflect.PtrTo(t), func(rw http.ResponseWriter, req *http.Request, v interface{}) error {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+
+		s, _ := api.sessionStore.Get(req, name)
+
+		// Save only where modified
+		current, ok := s.Values[sessionDataKey].(string)
+		if (ok && current == string(data)) || (!ok && bytes.Equal(data, empty)) {
+			return nil
+		}
+
+		s.Values[sessionDataKey] = string(data)
+		return s.Save(req, rw)
+	}); err != nil {
+		return err
+	}
+
+	api.sessions = append(api.sessions, name)
+	return nil
+}
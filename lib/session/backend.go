@@ -0,0 +1,37 @@
+package session
+
+import (
+	"errors"
+	"time"
+)
+
+// Interval between sweeps for expired sessions
+const pruneInterval = time.Minute
+
+// ErrNotFound is returned by backends where a session does not exist or has expired
+var ErrNotFound = errors.New("Session not found")
+
+// Backend stores encoded session data by session ID.
+// Implementations (ie. Redis or SQL) must be safe for concurrent use,
+// and should expire sessions after the provided TTL (where non-zero).
+type Backend interface {
+	// Load fetches session data, returning ErrNotFound for missing or expired sessions
+	Load(id string) ([]byte, error)
+	// Save stores session data with the provided TTL (0 for no expiry)
+	Save(id string, data []byte, ttl time.Duration) error
+	// Delete removes session data, succeeding where the session does not exist
+	Delete(id string) error
+}
+
+// expiry computes the expiry time for a TTL (zero for no expiry)
+func expiry(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
+
+// expired checks whether an expiry time has passed
+func expired(t time.Time) bool {
+	return !t.IsZero() && time.Now().After(t)
+}
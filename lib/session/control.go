@@ -0,0 +1,62 @@
+package session
+
+import (
+	"net/http"
+
+	"github.com/gorilla/sessions"
+
+	"github.com/ryankurte/go-api/lib/security"
+)
+
+// Rotator is implemented by session stores supporting session ID rotation
+type Rotator interface {
+	Rotate(req *http.Request, rw http.ResponseWriter, session *sessions.Session) error
+}
+
+type controlAction struct {
+	name   string
+	revoke bool
+}
+
+// Control allows typed handlers to rotate or revoke named sessions,
+// with actions applied after the handler returns without error.
+type Control struct {
+	actions []controlAction
+}
+
+// Rotate requests the named session be moved to a new session ID (ie. on login)
+func (c *Control) Rotate(name string) {
+	c.actions = append(c.actions, controlAction{name: name})
+}
+
+// Revoke requests the named session be deleted (ie. on logout)
+func (c *Control) Revoke(name string) {
+	c.actions = append(c.actions, controlAction{name: name, revoke: true})
+}
+
+// Apply applies requested actions using the provided store.
+// Where the store does not support rotation, rotated sessions are saved.
+// Where sessions are rotated any CSRF secret is also rotated (see security.RotateCSRFSecret).
+func (c *Control) Apply(store sessions.Store, rw http.ResponseWriter, req *http.Request) error {
+	rotated := false
+	for _, a := range c.actions {
+		s, _ := store.Get(req, a.name)
+
+		var err error
+		if a.revoke {
+			s.Options.MaxAge = -1
+			err = s.Save(req, rw)
+		} else if r, ok := store.(Rotator); ok {
+			err, rotated = r.Rotate(req, rw, s), true
+		} else {
+			err, rotated = s.Save(req, rw), true
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if rotated {
+		return security.RotateCSRFSecret(rw, req)
+	}
+	return nil
+}
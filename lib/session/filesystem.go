@@ -0,0 +1,139 @@
+package session
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Session IDs are URL safe base64, preventing path traversal
+var sessionIDRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Filesystem is a session backend storing sessions as files in a directory,
+// each prefixed with the session expiry time
+type Filesystem struct {
+	dir string
+
+	mu        sync.Mutex
+	lastPrune time.Time
+}
+
+// NewFilesystem creates a filesystem session backend in the provided directory
+func NewFilesystem(dir string) (*Filesystem, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("Error creating session directory (%s)", err)
+	}
+	return &Filesystem{dir: dir, lastPrune: time.Now()}, nil
+}
+
+func (f *Filesystem) path(id string) (string, error) {
+	if !sessionIDRegex.MatchString(id) {
+		return "", fmt.Errorf("Invalid session ID")
+	}
+	return filepath.Join(f.dir, "session_"+id), nil
+}
+
+// Load fetches session data
+func (f *Filesystem) Load(id string) ([]byte, error) {
+	p, err := f.path(id)
+	if err != nil {
+		return nil, err
+	}
+	return f.load(p)
+}
+
+func (f *Filesystem) load(p string) ([]byte, error) {
+	data, err := ioutil.ReadFile(p)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if len(data) < 8 {
+		return nil, fmt.Errorf("Invalid session file")
+	}
+
+	var expires time.Time
+	if t := int64(binary.BigEndian.Uint64(data[:8])); t != 0 {
+		expires = time.Unix(0, t)
+	}
+	if expired(expires) {
+		os.Remove(p)
+		return nil, ErrNotFound
+	}
+
+	return data[8:], nil
+}
+
+// Save stores session data, writing via a temporary file so sessions are replaced atomically
+func (f *Filesystem) Save(id string, data []byte, ttl time.Duration) error {
+	p, err := f.path(id)
+	if err != nil {
+		return err
+	}
+
+	buff := make([]byte, 8+len(data))
+	if e := expiry(ttl); !e.IsZero() {
+		binary.BigEndian.PutUint64(buff[:8], uint64(e.UnixNano()))
+	}
+	copy(buff[8:], data)
+
+	tmp, err := ioutil.TempFile(f.dir, "tmp_")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(buff); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	prune := time.Since(f.lastPrune) > pruneInterval
+	if prune {
+		f.lastPrune = time.Now()
+	}
+	f.mu.Unlock()
+	if prune {
+		go f.Prune()
+	}
+
+	return nil
+}
+
+// Prune removes expired session files
+func (f *Filesystem) Prune() {
+	files, err := filepath.Glob(filepath.Join(f.dir, "session_*"))
+	if err != nil {
+		return
+	}
+	for _, p := range files {
+		// Load removes expired sessions
+		f.load(p)
+	}
+}
+
+// Delete removes session data
+func (f *Filesystem) Delete(id string) error {
+	p, err := f.path(id)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package session
+
+import (
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	data    []byte
+	expires time.Time
+}
+
+// Memory is an in-memory session backend, for single instance deployments or as a stand-in for testing
+type Memory struct {
+	mu        sync.Mutex
+	sessions  map[string]memoryEntry
+	lastPrune time.Time
+}
+
+// NewMemory creates an in-memory session backend
+func NewMemory() *Memory {
+	return &Memory{sessions: make(map[string]memoryEntry), lastPrune: time.Now()}
+}
+
+// Load fetches session data
+func (m *Memory) Load(id string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.sessions[id]
+	if !ok || expired(e.expires) {
+		return nil, ErrNotFound
+	}
+	return e.data, nil
+}
+
+// Save stores session data, pruning expired sessions periodically
+func (m *Memory) Save(id string, data []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sessions[id] = memoryEntry{data: append([]byte{}, data...), expires: expiry(ttl)}
+
+	if time.Since(m.lastPrune) > pruneInterval {
+		for k, e := range m.sessions {
+			if expired(e.expires) {
+				delete(m.sessions, k)
+			}
+		}
+		m.lastPrune = time.Now()
+	}
+
+	return nil
+}
+
+// Delete removes session data
+func (m *Memory) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions, id)
+	return nil
+}
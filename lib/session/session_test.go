@@ -0,0 +1,182 @@
+package session
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testBackend(t *testing.T, b Backend) {
+	t.Run("Saves and loads sessions", func(t *testing.T) {
+		require.Nil(t, b.Save("test-id", []byte("data"), 0))
+
+		data, err := b.Load("test-id")
+		require.Nil(t, err)
+		assert.Equal(t, []byte("data"), data)
+	})
+
+	t.Run("Deletes sessions", func(t *testing.T) {
+		require.Nil(t, b.Delete("test-id"))
+		require.Nil(t, b.Delete("test-id"))
+
+		_, err := b.Load("test-id")
+		assert.Equal(t, ErrNotFound, err)
+	})
+
+	t.Run("Expires sessions", func(t *testing.T) {
+		require.Nil(t, b.Save("expiring-id", []byte("data"), 20*time.Millisecond))
+		_, err := b.Load("expiring-id")
+		require.Nil(t, err)
+
+		time.Sleep(40 * time.Millisecond)
+		_, err = b.Load("expiring-id")
+		assert.Equal(t, ErrNotFound, err)
+	})
+}
+
+func TestBackends(t *testing.T) {
+	t.Run("Memory", func(t *testing.T) {
+		testBackend(t, NewMemory())
+	})
+
+	t.Run("Filesystem", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "sessions")
+		require.Nil(t, err)
+		defer os.RemoveAll(dir)
+
+		f, err := NewFilesystem(dir)
+		require.Nil(t, err)
+		testBackend(t, f)
+
+		_, err = f.Load("../escape")
+		assert.NotNil(t, err)
+	})
+}
+
+func TestStore(t *testing.T) {
+	backend := NewMemory()
+	store := NewStore(backend, time.Hour, time.Hour, []byte("session-test-secret"))
+
+	// request performs a request with the provided cookies, returning any session cookie set
+	request := func(cookie *http.Cookie, fn func(rw http.ResponseWriter, req *http.Request)) *http.Cookie {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rw := httptest.NewRecorder()
+		fn(rw, req)
+		if c := rw.Result().Cookies(); len(c) > 0 {
+			return c[0]
+		}
+		return nil
+	}
+
+	get := func(req *http.Request) *sessions.Session {
+		s, err := store.Get(req, "test")
+		require.Nil(t, err)
+		return s
+	}
+
+	var cookie *http.Cookie
+
+	t.Run("Stores sessions server-side", func(t *testing.T) {
+		cookie = request(nil, func(rw http.ResponseWriter, req *http.Request) {
+			s := get(req)
+			assert.True(t, s.IsNew)
+			s.Values["user"] = "test-user"
+			require.Nil(t, s.Save(req, rw))
+		})
+		require.NotNil(t, cookie)
+		assert.NotContains(t, cookie.Value, "test-user")
+
+		request(cookie, func(rw http.ResponseWriter, req *http.Request) {
+			s := get(req)
+			assert.False(t, s.IsNew)
+			assert.Equal(t, "test-user", s.Values["user"])
+		})
+	})
+
+	t.Run("Rotates session IDs", func(t *testing.T) {
+		var previous string
+		rotated := request(cookie, func(rw http.ResponseWriter, req *http.Request) {
+			s := get(req)
+			previous = s.ID
+			require.Nil(t, store.Rotate(req, rw, s))
+			assert.NotEqual(t, previous, s.ID)
+		})
+		require.NotNil(t, rotated)
+
+		_, err := backend.Load(previous)
+		assert.Equal(t, ErrNotFound, err)
+
+		request(rotated, func(rw http.ResponseWriter, req *http.Request) {
+			assert.Equal(t, "test-user", get(req).Values["user"])
+		})
+		cookie = rotated
+	})
+
+	t.Run("Revokes sessions", func(t *testing.T) {
+		request(cookie, func(rw http.ResponseWriter, req *http.Request) {
+			require.Nil(t, store.Revoke(get(req).ID))
+		})
+
+		request(cookie, func(rw http.ResponseWriter, req *http.Request) {
+			assert.True(t, get(req).IsNew)
+		})
+	})
+
+	t.Run("Expires idle and aged sessions", func(t *testing.T) {
+		for _, s := range []*Store{
+			NewStore(backend, 20*time.Millisecond, 0, []byte("session-test-secret")),
+			NewStore(NewMemory(), 0, 20*time.Millisecond, []byte("session-test-secret")),
+		} {
+			c := request(nil, func(rw http.ResponseWriter, req *http.Request) {
+				session, _ := s.Get(req, "test")
+				session.Values["user"] = "test-user"
+				require.Nil(t, session.Save(req, rw))
+			})
+
+			time.Sleep(40 * time.Millisecond)
+
+			request(c, func(rw http.ResponseWriter, req *http.Request) {
+				session, _ := s.Get(req, "test")
+				assert.True(t, session.IsNew)
+			})
+		}
+	})
+
+	t.Run("Applies session controls", func(t *testing.T) {
+		c := request(nil, func(rw http.ResponseWriter, req *http.Request) {
+			s := get(req)
+			s.Values["user"] = "test-user"
+			require.Nil(t, s.Save(req, rw))
+		})
+
+		rotated := request(c, func(rw http.ResponseWriter, req *http.Request) {
+			control := Control{}
+			control.Rotate("test")
+			require.Nil(t, control.Apply(store, rw, req))
+		})
+		require.NotNil(t, rotated)
+		assert.NotEqual(t, c.Value, rotated.Value)
+
+		expired := request(rotated, func(rw http.ResponseWriter, req *http.Request) {
+			control := Control{}
+			control.Revoke("test")
+			require.Nil(t, control.Apply(store, rw, req))
+		})
+		require.NotNil(t, expired)
+		assert.True(t, expired.MaxAge < 0)
+
+		request(rotated, func(rw http.ResponseWriter, req *http.Request) {
+			assert.True(t, get(req).IsNew)
+		})
+	})
+}
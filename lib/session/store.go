@@ -0,0 +1,219 @@
+package session
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/gob"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+const (
+	sessionIDSize = 32
+	// Interval at which session access times are updated for idle timeouts
+	touchInterval = time.Minute
+)
+
+// createdKey holds the session creation time in session values (removed prior to storage)
+type createdKey struct{}
+
+// record is the stored form of a session
+type record struct {
+	Values   map[interface{}]interface{}
+	Created  time.Time
+	Accessed time.Time
+}
+
+// Store is a gorilla/sessions compatible store keeping session values in a server-side backend,
+// with only the signed session ID stored in the session cookie.
+// Sessions expire after MaxIdle without access or MaxLifetime since creation (where non-zero).
+type Store struct {
+	Options     *sessions.Options
+	MaxIdle     time.Duration
+	MaxLifetime time.Duration
+
+	backend Backend
+	codecs  []securecookie.Codec
+}
+
+// NewStore creates a server-side session store using the provided backend.
+// keyPairs are used to sign session ID cookies as with sessions.NewCookieStore,
+// and may include previous keys to allow rotation.
+func NewStore(backend Backend, maxIdle, maxLifetime time.Duration, keyPairs ...[]byte) *Store {
+	s := Store{
+		Options:     &sessions.Options{Path: "/", MaxAge: 86400 * 30},
+		MaxIdle:     maxIdle,
+		MaxLifetime: maxLifetime,
+		backend:     backend,
+		codecs:      securecookie.CodecsFromPairs(keyPairs...),
+	}
+	if maxLifetime > 0 {
+		s.Options.MaxAge = int(maxLifetime.Seconds())
+	}
+	return &s
+}
+
+// Get fetches a session for the request, cached for the duration of the request
+func (s *Store) Get(req *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(req).Get(s, name)
+}
+
+// New loads a session for the request, returning a new session where none exists or the session has expired
+func (s *Store) New(req *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	opts := *s.Options
+	session.Options = &opts
+	session.IsNew = true
+
+	c, err := req.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+
+	id := ""
+	if err := securecookie.DecodeMulti(name, c.Value, &id, s.codecs...); err != nil {
+		return session, err
+	}
+
+	r, err := s.load(id)
+	if err == ErrNotFound {
+		return session, nil
+	} else if err != nil {
+		return session, err
+	}
+
+	now := time.Now()
+	if (s.MaxIdle > 0 && now.Sub(r.Accessed) > s.MaxIdle) || (s.MaxLifetime > 0 && now.Sub(r.Created) > s.MaxLifetime) {
+		return session, s.backend.Delete(id)
+	}
+
+	// Update access time for idle timeouts
+	if s.MaxIdle > 0 && now.Sub(r.Accessed) > touchInterval {
+		r.Accessed = now
+		if err := s.store(id, r); err != nil {
+			return session, err
+		}
+	}
+
+	session.ID = id
+	session.Values = r.Values
+	session.Values[createdKey{}] = r.Created
+	session.IsNew = false
+
+	return session, nil
+}
+
+// Save stores a session, creating a session ID where required.
+// Sessions with a negative MaxAge are deleted (see Revoke).
+func (s *Store) Save(req *http.Request, rw http.ResponseWriter, session *sessions.Session) error {
+	if session.Options.MaxAge < 0 {
+		if session.ID != "" {
+			if err := s.backend.Delete(session.ID); err != nil {
+				return err
+			}
+		}
+		http.SetCookie(rw, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	if session.ID == "" {
+		id, err := newSessionID()
+		if err != nil {
+			return err
+		}
+		session.ID = id
+	}
+
+	created, ok := session.Values[createdKey{}].(time.Time)
+	if !ok {
+		created = time.Now()
+		session.Values[createdKey{}] = created
+	}
+
+	values := make(map[interface{}]interface{}, len(session.Values))
+	for k, v := range session.Values {
+		if _, ok := k.(createdKey); !ok {
+			values[k] = v
+		}
+	}
+
+	if err := s.store(session.ID, &record{Values: values, Created: created, Accessed: time.Now()}); err != nil {
+		return err
+	}
+
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(rw, sessions.NewCookie(session.Name(), encoded, session.Options))
+
+	return nil
+}
+
+// Rotate moves a session to a new session ID (ie. on login, to prevent session fixation)
+func (s *Store) Rotate(req *http.Request, rw http.ResponseWriter, session *sessions.Session) error {
+	previous := session.ID
+	session.ID = ""
+	if err := s.Save(req, rw, session); err != nil {
+		return err
+	}
+	if previous != "" {
+		return s.backend.Delete(previous)
+	}
+	return nil
+}
+
+// Revoke deletes a session by ID (ie. to log out a session from elsewhere)
+func (s *Store) Revoke(id string) error {
+	return s.backend.Delete(id)
+}
+
+func (s *Store) load(id string) (*record, error) {
+	data, err := s.backend.Load(id)
+	if err != nil {
+		return nil, err
+	}
+	r := record{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&r); err != nil {
+		return nil, err
+	}
+	if r.Values == nil {
+		r.Values = make(map[interface{}]interface{})
+	}
+	return &r, nil
+}
+
+func (s *Store) store(id string, r *record) error {
+	buff := bytes.Buffer{}
+	if err := gob.NewEncoder(&buff).Encode(r); err != nil {
+		return err
+	}
+	return s.backend.Save(id, buff.Bytes(), s.ttl(r.Created))
+}
+
+// ttl computes the backend TTL for a session, the lesser of the idle and remaining lifetime
+func (s *Store) ttl(created time.Time) time.Duration {
+	ttl := s.MaxIdle
+	if s.MaxLifetime > 0 {
+		remaining := s.MaxLifetime - time.Since(created)
+		if remaining <= 0 {
+			remaining = time.Second
+		}
+		if ttl == 0 || remaining < ttl {
+			ttl = remaining
+		}
+	}
+	return ttl
+}
+
+func newSessionID() (string, error) {
+	b := make([]byte, sessionIDSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,226 @@
+package api
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ryankurte/go-api/lib/options"
+	"github.com/ryankurte/go-api/lib/session"
+)
+
+// AppSession typed session object
+type AppSession struct {
+	Visits int
+}
+
+// Visit AppContext Endpoint handler function counting session visits
+func (c *AppContext) Visit(s *AppSession) (Response, error) {
+	s.Visits++
+	return Response{Message: "visited"}, nil
+}
+
+// Peek AppContext Endpoint handler function reading session visits without modification
+func (c *AppContext) Peek(s *AppSession) (Response, int, error) {
+	return Response{Message: "peeked"}, 200 + s.Visits, nil
+}
+
+// FailedVisit AppContext Endpoint handler function modifying the session then failing
+func (c *AppContext) FailedVisit(s *AppSession) (Response, error) {
+	s.Visits++
+	return Response{}, errors.New("failed")
+}
+
+// Rotate AppContext Endpoint handler function rotating the session ID
+func (c *AppContext) Rotate(s *session.Control) (Response, error) {
+	s.Rotate("test")
+	return Response{Message: "rotated"}, nil
+}
+
+func TestSession(t *testing.T) {
+	o := options.Base{}
+	o.NoTLS = true
+	o.Session.DisableSecure = true
+
+	api, err := New(AppContext{}, &o)
+	require.Nil(t, err)
+
+	require.NotNil(t, api.RegisterSession("test", 1))
+	require.Nil(t, api.RegisterSession("test", AppSession{}))
+	require.Nil(t, api.RegisterEndpoint("/visit", "GET", (*AppContext).Visit))
+	require.Nil(t, api.RegisterEndpoint("/peek", "GET", (*AppContext).Peek))
+	require.Nil(t, api.RegisterEndpoint("/fail", "GET", (*AppContext).FailedVisit))
+
+	cookies := make([]*http.Cookie, 0)
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rw := httptest.NewRecorder()
+		api.GetBaseRouter().ServeHTTP(rw, req)
+		if c := rw.Result().Cookies(); len(c) > 0 {
+			cookies = c
+		}
+		return rw
+	}
+
+	t.Run("Does not save unmodified sessions", func(t *testing.T) {
+		rw := get("/peek")
+		assert.Equal(t, 200, rw.Code)
+		assert.Len(t, rw.Result().Cookies(), 0)
+	})
+
+	t.Run("Saves modified sessions", func(t *testing.T) {
+		rw := get("/visit")
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Len(t, rw.Result().Cookies(), 1)
+		assert.Equal(t, 86400*30, rw.Result().Cookies()[0].MaxAge)
+
+		get("/visit")
+		assert.Equal(t, 202, get("/peek").Code)
+	})
+
+	t.Run("Does not save sessions on handler error", func(t *testing.T) {
+		rw := get("/fail")
+		assert.Equal(t, http.StatusInternalServerError, rw.Code)
+		assert.Len(t, rw.Result().Cookies(), 0)
+		assert.Equal(t, 202, get("/peek").Code)
+	})
+
+	t.Run("Rejects duplicate session types", func(t *testing.T) {
+		assert.NotNil(t, api.RegisterSession("duplicate", AppSession{}))
+	})
+
+	t.Run("Scopes sessions to the API instance", func(t *testing.T) {
+		other, err := New(AppContext{}, &o)
+		require.Nil(t, err)
+		require.Nil(t, other.RegisterSession("other", AppSession{}))
+
+		assert.Equal(t, 202, get("/peek").Code)
+	})
+}
+
+func TestSessionControl(t *testing.T) {
+	newAPI := func() *API {
+		o := options.Base{}
+		o.NoTLS = true
+		o.Session.DisableSecure = true
+		o.Session.Backend = options.SessionBackendMemory
+
+		api, err := New(AppContext{}, &o)
+		require.Nil(t, err)
+		require.Nil(t, api.RegisterSession("test", AppSession{}))
+		require.Nil(t, api.RegisterEndpoint("/visit", "GET", (*AppContext).Visit))
+		require.Nil(t, api.RegisterEndpoint("/peek", "GET", (*AppContext).Peek))
+		require.Nil(t, api.RegisterEndpoint("/rotate", "GET", (*AppContext).Rotate))
+		return api
+	}
+	api := newAPI()
+	newAPI()
+
+	var cookie *http.Cookie
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rw := httptest.NewRecorder()
+		api.GetBaseRouter().ServeHTTP(rw, req)
+		if c := rw.Result().Cookies(); len(c) > 0 {
+			cookie = c[0]
+		}
+		return rw
+	}
+
+	t.Run("Rotates sessions using the API instance store", func(t *testing.T) {
+		get("/visit")
+		previous := cookie
+
+		assert.Equal(t, http.StatusOK, get("/rotate").Code)
+		assert.NotEqual(t, previous.Value, cookie.Value)
+		assert.Equal(t, 201, get("/peek").Code)
+	})
+}
+
+func TestSessionSecrets(t *testing.T) {
+	// previous optionally contains a previous secret and encryption key
+	newAPI := func(secret, key string, previous ...string) *API {
+		o := options.Base{}
+		o.NoTLS = true
+		o.Session.DisableSecure = true
+		o.Session.Secret = secret
+		o.Session.EncryptionKey = key
+		if len(previous) == 2 {
+			o.Session.PreviousSecrets = previous[:1]
+			o.Session.PreviousEncryptionKeys = previous[1:]
+		}
+
+		api, err := New(AppContext{}, &o)
+		require.Nil(t, err)
+		require.Nil(t, api.RegisterSession("test", AppSession{}))
+		require.Nil(t, api.RegisterEndpoint("/visit", "GET", (*AppContext).Visit))
+		require.Nil(t, api.RegisterEndpoint("/peek", "GET", (*AppContext).Peek))
+		return api
+	}
+
+	get := func(api *API, path string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rw := httptest.NewRecorder()
+		api.GetBaseRouter().ServeHTTP(rw, req)
+		return rw
+	}
+
+	rw := get(newAPI("old-secret", "old-key"), "/visit", nil)
+	require.Len(t, rw.Result().Cookies(), 1)
+	cookie := rw.Result().Cookies()[0]
+
+	t.Run("Accepts sessions signed with previous secrets", func(t *testing.T) {
+		api := newAPI("new-secret", "new-key", "old-secret", "old-key")
+		assert.Equal(t, 201, get(api, "/peek", cookie).Code)
+	})
+
+	t.Run("Rejects sessions signed with unknown secrets", func(t *testing.T) {
+		assert.Equal(t, 200, get(newAPI("new-secret", "new-key"), "/peek", cookie).Code)
+	})
+
+	t.Run("Loads secrets from files and environment", func(t *testing.T) {
+		f, err := ioutil.TempFile("", "secret")
+		require.Nil(t, err)
+		defer os.Remove(f.Name())
+		_, err = f.WriteString("old-secret\n")
+		require.Nil(t, err)
+		f.Close()
+
+		os.Setenv("TEST_SESSION_KEY", "old-key")
+		defer os.Unsetenv("TEST_SESSION_KEY")
+
+		api := newAPI(options.SecretFilePrefix+f.Name(), options.SecretEnvPrefix+"TEST_SESSION_KEY")
+		assert.Equal(t, 201, get(api, "/peek", cookie).Code)
+
+		o := options.Base{}
+		o.Session.Secret = options.SecretEnvPrefix + "TEST_MISSING_SECRET"
+		_, err = New(AppContext{}, &o)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("Requires secrets in serverless modes", func(t *testing.T) {
+		o := options.Base{Mode: options.ModeLambda}
+		_, err := New(AppContext{}, &o)
+		assert.NotNil(t, err)
+
+		o = options.Base{Mode: options.ModeHTTP}
+		o.Session.RequireSecret = true
+		_, err = New(AppContext{}, &o)
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,157 @@
+// Package tracing provides OpenTelemetry tracing through the API handler chain and endpoint wrappers
+package tracing
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ryankurte/go-api/lib/response"
+	"github.com/ryankurte/go-api/lib/wrappers"
+)
+
+// Exporter exports completed spans
+type Exporter = sdktrace.SpanExporter
+
+// NewStdoutExporter creates an exporter writing JSON encoded spans to the provided writer
+func NewStdoutExporter(w io.Writer) (Exporter, error) {
+	return stdouttrace.New(stdouttrace.WithWriter(w))
+}
+
+// NewMemoryExporter creates an exporter storing spans in memory, for use in testing
+func NewMemoryExporter() *tracetest.InMemoryExporter {
+	return tracetest.NewInMemoryExporter()
+}
+
+// Tracing traces requests from the edge of the handler chain through endpoint wrapper phases.
+// This implements wrappers.Instrument for binding to endpoints.
+type Tracing struct {
+	provider   *sdktrace.TracerProvider
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+// New creates a tracing instance for the named service, sampling the provided ratio of new traces.
+// Sampling decisions of incoming traces are respected.
+func New(service string, ratio float64) *Tracing {
+	res := resource.NewSchemaless(attribute.String("service.name", service))
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+
+	return &Tracing{
+		provider:   provider,
+		tracer:     provider.Tracer("github.com/ryankurte/go-api"),
+		propagator: propagation.TraceContext{},
+	}
+}
+
+// AddExporter registers an exporter for completed spans
+func (t *Tracing) AddExporter(e Exporter) {
+	t.provider.RegisterSpanProcessor(sdktrace.NewBatchSpanProcessor(e))
+}
+
+// Tracer fetches the underlying tracer for creation of application spans
+func (t *Tracing) Tracer() trace.Tracer {
+	return t.tracer
+}
+
+// Flush exports any pending spans
+func (t *Tracing) Flush(ctx context.Context) error {
+	return t.provider.ForceFlush(ctx)
+}
+
+// Close flushes pending spans and shuts down exporters
+func (t *Tracing) Close(ctx context.Context) error {
+	return t.provider.Shutdown(ctx)
+}
+
+// Middleware extracts W3C traceparent headers from incoming requests,
+// starting a server span and propagating it via the request context.
+func (t *Tracing) Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		ctx := t.propagator.Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+
+		ctx, span := t.tracer.Start(ctx, req.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", req.Method),
+				attribute.String("url.path", req.URL.Path),
+			),
+		)
+		defer span.End()
+
+		sw := response.NewWriter(rw)
+		h.ServeHTTP(sw, req.WithContext(ctx))
+
+		status := sw.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	})
+}
+
+// Start begins observation of a request to the provided endpoint,
+// naming the request span by route template.
+func (t *Tracing) Start(e wrappers.Endpoint, req *http.Request) wrappers.Observer {
+	span := trace.SpanFromContext(req.Context())
+	span.SetName(e.Method + " " + e.Route)
+	span.SetAttributes(attribute.String("http.route", e.Route))
+
+	return &observer{tracer: t.tracer, ctx: req.Context()}
+}
+
+// observer creates spans for wrapper phases of a single request
+type observer struct {
+	tracer trace.Tracer
+	ctx    context.Context
+}
+
+func (o *observer) Phase(name string) func(err error) {
+	_, done := o.PhaseContext(o.ctx, name)
+	return done
+}
+
+// PhaseContext starts a span for the phase as a child of any span in the provided context,
+// returning a context carrying the phase span (see wrappers.ContextObserver)
+func (o *observer) PhaseContext(ctx context.Context, name string) (context.Context, func(err error)) {
+	ctx, span := o.tracer.Start(ctx, name)
+	return ctx, func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+func (o *observer) Finish(status int) {}
+
+// LogFields fetches trace and span ID log fields for the span in the provided context
+func LogFields(ctx context.Context) log.Fields {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return log.Fields{}
+	}
+
+	return log.Fields{
+		"trace_id": sc.TraceID().String(),
+		"span_id":  sc.SpanID().String(),
+	}
+}
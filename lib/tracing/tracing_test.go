@@ -0,0 +1,162 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ryankurte/go-api/lib/wrappers"
+)
+
+type Context struct{}
+
+type Message struct {
+	Message string `valid:"ascii,required"`
+}
+
+const (
+	traceID      = "4bf92f3577b34da6a3ce929d0e0e4736"
+	parentSpanID = "00f067aa0ba902b7"
+)
+
+func TestTracing(t *testing.T) {
+	contextType := reflect.TypeOf((*context.Context)(nil)).Elem()
+	wrappers.RegisterInjector(contextType, func(req *http.Request) (interface{}, error) {
+		return req.Context(), nil
+	})
+	defer wrappers.RemoveInjector(contextType)
+
+	tr := New("test", 1.0)
+	exporter := NewMemoryExporter()
+	tr.AddExporter(exporter)
+
+	handlerTraceID, handlerSpanID := "", ""
+	e := wrappers.Endpoint{Route: "/users/:id", Method: http.MethodPost}
+	w, err := wrappers.BuildEndpoint(http.MethodPost, func(c Context, i Message, ctx context.Context) (Message, error) {
+		handlerTraceID = trace.SpanContextFromContext(ctx).TraceID().String()
+		handlerSpanID = trace.SpanContextFromContext(ctx).SpanID().String()
+		if i.Message == "fail" {
+			return i, fmt.Errorf("failed")
+		}
+		return i, nil
+	}, e, tr)
+	require.Nil(t, err)
+
+	h := tr.Middleware(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		w(Context{}, rw, req)
+	}))
+
+	call := func(body string, traceparent string) {
+		exporter.Reset()
+		req := httptest.NewRequest(http.MethodPost, "/users/1234", bytes.NewReader([]byte(body)))
+		if traceparent != "" {
+			req.Header.Set("traceparent", traceparent)
+		}
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		require.Nil(t, tr.Flush(context.Background()))
+	}
+
+	t.Run("Continues incoming traces", func(t *testing.T) {
+		call(`{"Message":"test"}`, fmt.Sprintf("00-%s-%s-01", traceID, parentSpanID))
+
+		spans := exporter.GetSpans()
+		require.Len(t, spans, 7)
+
+		names := make([]string, 0)
+		for _, s := range spans {
+			assert.Equal(t, traceID, s.SpanContext.TraceID().String())
+			names = append(names, s.Name)
+		}
+		assert.ElementsMatch(t, []string{"decode", "validate", "inject", "handler", "validate", "encode", "POST /users/:id"}, names)
+
+		root := spans[len(spans)-1]
+		assert.Equal(t, "POST /users/:id", root.Name)
+		assert.Equal(t, parentSpanID, root.Parent.SpanID().String())
+
+		// Injection runs within the handler phase, other phases are children of the request span
+		var handler trace.SpanContext
+		for _, s := range spans {
+			if s.Name == "handler" {
+				handler = s.SpanContext
+			}
+		}
+		for _, s := range spans[:len(spans)-1] {
+			if s.Name == "inject" {
+				assert.Equal(t, handler.SpanID(), s.Parent.SpanID())
+			} else {
+				assert.Equal(t, root.SpanContext.SpanID(), s.Parent.SpanID())
+			}
+		}
+	})
+
+	t.Run("Propagates the handler span to handler context", func(t *testing.T) {
+		call(`{"Message":"test"}`, fmt.Sprintf("00-%s-%s-01", traceID, parentSpanID))
+		assert.Equal(t, traceID, handlerTraceID)
+
+		var handler string
+		for _, s := range exporter.GetSpans() {
+			if s.Name == "handler" {
+				handler = s.SpanContext.SpanID().String()
+			}
+		}
+		assert.NotEqual(t, "", handler)
+		assert.Equal(t, handler, handlerSpanID)
+	})
+
+	t.Run("Starts new traces", func(t *testing.T) {
+		call(`{"Message":"test"}`, "")
+
+		spans := exporter.GetSpans()
+		require.Len(t, spans, 7)
+		assert.NotEqual(t, traceID, spans[0].SpanContext.TraceID().String())
+		assert.False(t, spans[len(spans)-1].Parent.IsValid())
+	})
+
+	t.Run("Records phase errors", func(t *testing.T) {
+		call(`{"Message":"fail"}`, "")
+
+		spans := exporter.GetSpans()
+		require.Len(t, spans, 5)
+		assert.Equal(t, "handler", spans[3].Name)
+		assert.Equal(t, codes.Error, spans[3].Status.Code)
+		assert.Equal(t, codes.Error, spans[4].Status.Code)
+	})
+
+	t.Run("Passes through streaming responses and records the first status", func(t *testing.T) {
+		exporter.Reset()
+		h := tr.Middleware(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			f, ok := rw.(http.Flusher)
+			require.True(t, ok)
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			f.Flush()
+			rw.WriteHeader(http.StatusOK)
+		}))
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/events", nil))
+		require.Nil(t, tr.Flush(context.Background()))
+		assert.True(t, rec.Flushed)
+
+		spans := exporter.GetSpans()
+		require.Len(t, spans, 1)
+		assert.Equal(t, codes.Error, spans[0].Status.Code)
+	})
+
+	t.Run("Provides log fields", func(t *testing.T) {
+		sc := trace.NewSpanContext(trace.SpanContextConfig{TraceID: trace.TraceID{1}, SpanID: trace.SpanID{2}})
+		fields := LogFields(trace.ContextWithSpanContext(context.Background(), sc))
+		assert.Equal(t, sc.TraceID().String(), fields["trace_id"])
+		assert.Equal(t, sc.SpanID().String(), fields["span_id"])
+
+		assert.Empty(t, LogFields(context.Background()))
+	})
+}
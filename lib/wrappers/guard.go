@@ -0,0 +1,11 @@
+package wrappers
+
+import (
+	"net/http"
+)
+
+// Guard argument is called prior to decoding requests (ie. to authenticate requests), returning
+// the request to continue with (ie. with an authenticated principal attached to the context),
+// or a status code and error to reject the request. Guards may set response headers
+// (ie. WWW-Authenticate) prior to rejecting a request.
+type Guard func(rw http.ResponseWriter, req *http.Request) (*http.Request, int, error)
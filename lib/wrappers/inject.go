@@ -0,0 +1,160 @@
+package wrappers
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+)
+
+// Injector resolves a handler parameter of a registered type from the incoming request
+type Injector func(req *http.Request) (interface{}, error)
+
+// Finalizer is called with an injected parameter after the handler returns without error,
+// prior to the response being written (ie. to persist modifications to the parameter)
+type Finalizer func(rw http.ResponseWriter, req *http.Request, v interface{}) error
+
+// Injectors is a registry of parameter injectors and finalizers, which may be passed to BuildEndpoint
+// to scope injection to an API instance (ie. for parameters bound to the instance session store).
+// Types not registered with the registry are resolved using the global injectors (see RegisterInjector).
+type Injectors struct {
+	mu         sync.RWMutex
+	parent     *Injectors
+	injectors  map[reflect.Type]Injector
+	finalizers map[reflect.Type]Finalizer
+}
+
+// NewInjectors creates an empty injector registry, falling back to the global injectors
+func NewInjectors() *Injectors {
+	return &Injectors{
+		parent:     globalInjectors,
+		injectors:  make(map[reflect.Type]Injector),
+		finalizers: make(map[reflect.Type]Finalizer),
+	}
+}
+
+// Register binds an injector for handler parameters of the provided type,
+// returning an error where an injector is already registered for the type
+func (r *Injectors) Register(t reflect.Type, i Injector) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.injectors[t]; ok {
+		return fmt.Errorf("Injector already registered for type: %s", t)
+	}
+	r.injectors[t] = i
+	return nil
+}
+
+// RegisterFinalizer binds a finalizer for injected handler parameters of the provided type,
+// returning an error where a finalizer is already registered for the type
+func (r *Injectors) RegisterFinalizer(t reflect.Type, f Finalizer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.finalizers[t]; ok {
+		return fmt.Errorf("Finalizer already registered for type: %s", t)
+	}
+	r.finalizers[t] = f
+	return nil
+}
+
+// Remove removes the injector (and any finalizer) for the provided type
+func (r *Injectors) Remove(t reflect.Type) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.injectors, t)
+	delete(r.finalizers, t)
+}
+
+// IsInjectable checks whether an injector is registered for the provided type
+func (r *Injectors) IsInjectable(t reflect.Type) bool {
+	_, ok := r.injector(t)
+	return ok
+}
+
+func (r *Injectors) injector(t reflect.Type) (Injector, bool) {
+	r.mu.RLock()
+	i, ok := r.injectors[t]
+	r.mu.RUnlock()
+
+	if !ok && r.parent != nil {
+		return r.parent.injector(t)
+	}
+	return i, ok
+}
+
+func (r *Injectors) finalizer(t reflect.Type) (Finalizer, bool) {
+	r.mu.RLock()
+	f, ok := r.finalizers[t]
+	r.mu.RUnlock()
+
+	if !ok && r.parent != nil {
+		return r.parent.finalizer(t)
+	}
+	return f, ok
+}
+
+// inject resolves a parameter value of the provided type
+func (r *Injectors) inject(t reflect.Type, req *http.Request) (reflect.Value, error) {
+	i, ok := r.injector(t)
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("No injector registered for type: %s", t)
+	}
+
+	v, err := i(req)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	if v == nil {
+		return reflect.Zero(t), nil
+	}
+
+	return reflect.ValueOf(v), nil
+}
+
+// finalize calls the finalizer (if registered) for an injected parameter value
+func (r *Injectors) finalize(t reflect.Type, v reflect.Value, rw http.ResponseWriter, req *http.Request) error {
+	f, ok := r.finalizer(t)
+	if !ok {
+		return nil
+	}
+	return f(rw, req, v.Interface())
+}
+
+// Global parameter injectors, used by all endpoints
+var globalInjectors = &Injectors{
+	injectors: map[reflect.Type]Injector{
+		reflect.TypeOf(http.Header{}): func(req *http.Request) (interface{}, error) {
+			return req.Header, nil
+		},
+	},
+	finalizers: map[reflect.Type]Finalizer{},
+}
+
+// RegisterInjector Bind a global injector for handler parameters of the provided type.
+// Injected parameters may follow the context (and optional input) parameter in any order.
+// Injectors bound to an API instance should instead be registered with an Injectors registry.
+func RegisterInjector(t reflect.Type, i Injector) {
+	globalInjectors.mu.Lock()
+	defer globalInjectors.mu.Unlock()
+	globalInjectors.injectors[t] = i
+}
+
+// RemoveInjector Remove a global injector (and any finalizer) for the provided type
+func RemoveInjector(t reflect.Type) {
+	globalInjectors.Remove(t)
+}
+
+// RegisterFinalizer Bind a global finalizer for injected handler parameters of the provided type
+func RegisterFinalizer(t reflect.Type, f Finalizer) {
+	globalInjectors.mu.Lock()
+	defer globalInjectors.mu.Unlock()
+	globalInjectors.finalizers[t] = f
+}
+
+// IsInjectable checks whether a global injector is registered for the provided type
+func IsInjectable(t reflect.Type) bool {
+	return globalInjectors.IsInjectable(t)
+}
@@ -0,0 +1,92 @@
+package wrappers
+
+import (
+	"context"
+	"net/http"
+)
+
+// Endpoint argument describes the route template and method an endpoint is bound to,
+// for use by instruments in place of the raw request path.
+type Endpoint struct {
+	Route  string
+	Method string
+}
+
+// Wrapper pipeline phase names
+const (
+	PhaseGuard    = "guard"
+	PhaseDecode   = "decode"
+	PhaseValidate = "validate"
+	PhaseInject   = "inject"
+	PhaseHandler  = "handler"
+	PhaseEncode   = "encode"
+)
+
+// Instrument argument observes requests through the endpoint wrapper pipeline
+type Instrument interface {
+	// Start is called at the start of each request, returning an observer for the request
+	Start(e Endpoint, req *http.Request) Observer
+}
+
+// Observer observes a single request through the endpoint wrapper pipeline
+type Observer interface {
+	// Phase is called at the start of a pipeline phase, returning a function to be called
+	// on completion of the phase with any resulting error.
+	Phase(name string) func(err error)
+	// Finish is called with the response status on completion of the request
+	Finish(status int)
+}
+
+// ContextObserver is implemented by observers attaching phases to the request context (ie. trace spans).
+// The context for the handler phase is attached to the request prior to injection,
+// so injected contexts and loggers carry the handler phase (ie. for handlers creating child spans).
+type ContextObserver interface {
+	Observer
+	// PhaseContext starts a phase within the provided context as with Phase, returning a context carrying the phase
+	PhaseContext(ctx context.Context, name string) (context.Context, func(err error))
+}
+
+// observers combines the observers for each instrument bound to an endpoint
+type observers []Observer
+
+func startObservers(instruments []Instrument, e Endpoint, req *http.Request) observers {
+	o := make(observers, len(instruments))
+	for i, inst := range instruments {
+		o[i] = inst.Start(e, req)
+	}
+	return o
+}
+
+func (o observers) Phase(name string) func(err error) {
+	done := make([]func(err error), len(o))
+	for i, obs := range o {
+		done[i] = obs.Phase(name)
+	}
+	return func(err error) {
+		for _, d := range done {
+			d(err)
+		}
+	}
+}
+
+func (o observers) PhaseContext(ctx context.Context, name string) (context.Context, func(err error)) {
+	done := make([]func(err error), len(o))
+	for i, obs := range o {
+		if c, ok := obs.(ContextObserver); ok {
+			ctx, done[i] = c.PhaseContext(ctx, name)
+		} else {
+			done[i] = obs.Phase(name)
+		}
+	}
+	return ctx, func(err error) {
+		for _, d := range done {
+			d(err)
+		}
+	}
+}
+
+func (o observers) Finish(status int) {
+	for _, obs := range o {
+		obs.Finish(status)
+	}
+}
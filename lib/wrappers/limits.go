@@ -0,0 +1,42 @@
+package wrappers
+
+import (
+	"fmt"
+	"io"
+)
+
+// MaxBodySize argument limits the size of request bodies decoded by an endpoint (in bytes).
+// Bodies exceeding this size result in a http.StatusRequestEntityTooLarge error. A size of 0 disables the limit.
+type MaxBodySize int64
+
+// limitedBody wraps a request body, failing reads beyond the configured limit
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+	exceeded  bool
+}
+
+func newLimitedBody(body io.ReadCloser, limit MaxBodySize) *limitedBody {
+	return &limitedBody{ReadCloser: body, remaining: int64(limit)}
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	if l.exceeded {
+		return 0, fmt.Errorf("Request body too large")
+	}
+
+	// Read one byte beyond the limit to detect oversized bodies
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+
+	n, err := l.ReadCloser.Read(p)
+	if int64(n) > l.remaining {
+		l.exceeded = true
+		n = int(l.remaining)
+		err = fmt.Errorf("Request body too large")
+	}
+	l.remaining -= int64(n)
+
+	return n, err
+}
@@ -0,0 +1,44 @@
+package wrappers
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/ryankurte/go-api/lib/logging"
+)
+
+// PanicReporter argument is called with the request, recovered value and stack trace when a handler panics,
+// for reporting to external error tracking services.
+type PanicReporter func(req *http.Request, recovered interface{}, stack []byte)
+
+// Recover middleware recovers panics in the provided handler, logging the stack with the request scoped logger,
+// calling any provided reporters and responding with a http.StatusInternalServerError via the DefaultErrorHandler.
+// Typed endpoints recover panics within the wrapper, so this covers handlers registered without wrapping.
+// Panics with http.ErrAbortHandler are re-panicked so the server aborts the response.
+func Recover(h http.Handler, reporters ...PanicReporter) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		defer func() {
+			if p := recover(); p != nil {
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+				handlePanic(req, p, reporters)
+				DefaultErrorHandler(nil, rw, req, http.StatusInternalServerError, "Internal Server Error")
+			}
+		}()
+
+		h.ServeHTTP(rw, req)
+	})
+}
+
+// handlePanic logs and reports a recovered panic
+func handlePanic(req *http.Request, p interface{}, reporters []PanicReporter) {
+	stack := debug.Stack()
+
+	logging.Logger(req.Context()).WithField("stack", string(stack)).Errorf("Recovered panic: %s", fmt.Sprint(p))
+
+	for _, r := range reporters {
+		r(req, p, stack)
+	}
+}
@@ -1,13 +1,16 @@
 package wrappers
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"reflect"
 	"strings"
 
 	"github.com/asaskevich/govalidator"
-	log "github.com/sirupsen/logrus"
+
+	"github.com/ryankurte/go-api/lib/logging"
+	"github.com/ryankurte/go-api/lib/response"
 )
 
 // HTTPHandler is a standard http endpoint handler for binding into a http mux
@@ -28,8 +31,8 @@ type Encoder func(rw http.ResponseWriter, req *http.Request, output interface{},
 // DefaultErrorHandler ErrorHandler used if no error handling argument is passed to BuildEndpoint
 var DefaultErrorHandler = func(ctx interface{}, rw http.ResponseWriter, req *http.Request, code int, format string, args ...interface{}) {
 	rw.WriteHeader(code)
-	msg := fmt.Sprintf(format, args)
-	log.Warningln(msg)
+	msg := fmt.Sprintf(format, args...)
+	logging.Logger(req.Context()).Warningln(msg)
 	rw.Write([]byte(msg))
 }
 
@@ -43,24 +46,38 @@ var DefaultDecoder Decoder = decodeRequest
 var DefaultEncoder Encoder = encodeResponse
 
 // BuildEndpoint Build and return and endpoint handler for the provided function and method
-// Supports handler functions with (i InputType), (i InputType, h http.Header) or (ctx interface{}, i InputType, http.header) input parameters
+// Supports handler functions with (i InputType), (i InputType, h http.Header) or (ctx interface{}, i InputType, http.header) input parameters,
+// where http.Header may be replaced or followed by any number of parameters with registered injectors (see RegisterInjector and Injectors),
 // and (OutputType, error), (OutputType, int, error) or (OutputType, int, http.Header, error) output parameters where int is a http.Status code.
-// args may include an ErrorHandler to override the DefaultError handler.
+// args may include an ErrorHandler, ValidateHandler, Decoder or Encoder to override the defaults,
+// a MaxBodySize to limit the size of decoded request bodies, an Endpoint and Instruments to observe requests,
+// Guards to authenticate or otherwise reject requests prior to decoding, PanicReporters to be called when the handler panics (panics are otherwise recovered with a 500 response),
+// and an Injectors registry to resolve injected parameters not registered globally.
 func BuildEndpoint(method string, fn interface{}, args ...interface{}) (HTTPHandler, error) {
 
 	// Validate function prior to binding
-	err := validateFn(fn)
+	err := validateFn(fn, injectorsFor(args))
 	if err != nil {
 		return nil, err
 	}
 
 	// Generate a wrapper function for binding
-	w := generateWrapper(method, fn)
+	w := generateWrapper(method, fn, args...)
 
 	return w, nil
 }
 
-func validateFn(fn interface{}) error {
+// injectorsFor fetches the Injectors registry passed in endpoint arguments, or the global injectors where none is passed
+func injectorsFor(args []interface{}) *Injectors {
+	for _, a := range args {
+		if i, ok := a.(*Injectors); ok && i != nil {
+			return i
+		}
+	}
+	return globalInjectors
+}
+
+func validateFn(fn interface{}, injectors *Injectors) error {
 	vf := reflect.ValueOf(fn)
 	ftype := vf.Type()
 
@@ -70,11 +87,13 @@ func validateFn(fn interface{}) error {
 	}
 
 	argCount := ftype.NumIn()
-	if argCount < 1 || argCount > 3 {
+	if argCount < 1 {
 		return fmt.Errorf("Function %s invalid input parameter count", ftype.Name())
 	}
-	if argCount > 2 && ftype.In(2) != reflect.TypeOf(http.Header{}) {
-		return fmt.Errorf("Function %s third input parameter should be of type 'http.Header' not '%s'", ftype.Name(), ftype.In(2).Name())
+	for i := 2; i < argCount; i++ {
+		if !injectors.IsInjectable(ftype.In(i)) {
+			return fmt.Errorf("Function %s input parameter (%d) should be of type 'http.Header' or a registered injectable type not '%s'", ftype.Name(), i, ftype.In(i).Name())
+		}
 	}
 
 	returnCount := ftype.NumOut()
@@ -95,7 +114,7 @@ func validateFn(fn interface{}) error {
 	}
 
 	// Parse input and output types
-	inputType, outputType := GetTypes(fn)
+	inputType, outputType := GetTypes(fn, injectors)
 
 	if inputType != nil {
 		var a interface{}
@@ -110,14 +129,16 @@ func validateFn(fn interface{}) error {
 	return nil
 }
 
-// GetTypes fetches the associated input and output types for a supported handler function
-func GetTypes(fn interface{}) (input, output reflect.Type) {
+// GetTypes fetches the associated input and output types for a supported handler function,
+// using any Injectors registry in the provided endpoint arguments to identify injected parameters
+func GetTypes(fn interface{}, args ...interface{}) (input, output reflect.Type) {
+	injectors := injectorsFor(args)
 	vf := reflect.ValueOf(fn)
 	ftype := vf.Type()
 
 	// Parse input and output types
 	var inputType reflect.Type
-	if ftype.NumIn() == 1 {
+	if ftype.NumIn() == 1 || injectors.IsInjectable(ftype.In(1)) {
 		inputType = nil
 	} else {
 		inputType = ftype.In(1)
@@ -134,12 +155,18 @@ func generateWrapper(method string, fn interface{}, args ...interface{}) HTTPHan
 	numOut := vf.Type().NumOut()
 
 	// Parse input and output types
-	inputType, _ := GetTypes(fn)
+	injectors := injectorsFor(args)
+	inputType, _ := GetTypes(fn, injectors)
 
 	// Process varadic arguments
 	errorHandler := DefaultErrorHandler
 	validateHander := DefaultValidateHandler
 	decoder, encoder := DefaultDecoder, DefaultEncoder
+	maxBodySize := MaxBodySize(0)
+	endpoint := Endpoint{Method: method}
+	instruments := make([]Instrument, 0)
+	reporters := make([]PanicReporter, 0)
+	guards := make([]Guard, 0)
 	for _, a := range args {
 		switch a := a.(type) {
 		// Bind error handler argument if present
@@ -151,25 +178,108 @@ func generateWrapper(method string, fn interface{}, args ...interface{}) HTTPHan
 			decoder = a
 		case Encoder:
 			encoder = a
+		case MaxBodySize:
+			maxBodySize = a
+		case Endpoint:
+			endpoint = a
+		case Instrument:
+			instruments = append(instruments, a)
+		case PanicReporter:
+			reporters = append(reporters, a)
+		case Guard:
+			guards = append(guards, a)
 		}
 	}
 
 	return func(ctx interface{}, rw http.ResponseWriter, req *http.Request) {
 		var err error
 
+		// Start request observation
+		obs := startObservers(instruments, endpoint, req)
+		if len(obs) > 0 {
+			sw := response.NewWriter(rw)
+			rw = sw
+			defer func() { obs.Finish(sw.Status()) }()
+		}
+
+		// Track active (possibly nested) phases so they are ended where the handler panics
+		active := make([]func(err error), 0)
+		track := func(done func(err error)) func(err error) {
+			active = append(active, done)
+			return func(err error) {
+				active = active[:len(active)-1]
+				done(err)
+			}
+		}
+		phase := func(name string) func(err error) {
+			return track(obs.Phase(name))
+		}
+		phaseContext := func(c context.Context, name string) (context.Context, func(err error)) {
+			c, done := obs.PhaseContext(c, name)
+			return c, track(done)
+		}
+
+		// Recover handler panics, re-panicking http.ErrAbortHandler to abort the response
+		defer func() {
+			if p := recover(); p != nil {
+				for i := len(active) - 1; i >= 0; i-- {
+					active[i](fmt.Errorf("Panic: %v", p))
+				}
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+				handlePanic(req, p, reporters)
+				errorHandler(ctx, rw, req, http.StatusInternalServerError, "Internal Server Error")
+			}
+		}()
+
+		// Run guards prior to processing the request
+		if len(guards) > 0 {
+			done := phase(PhaseGuard)
+			for _, g := range guards {
+				r, status, err := g(rw, req)
+				if err != nil {
+					done(err)
+					errorHandler(ctx, rw, req, status, "%s", err)
+					return
+				}
+				req = r
+			}
+			done(nil)
+		}
+
 		// Generate input arguments
 		var inputs = []reflect.Value{reflect.ValueOf(ctx)}
-		if numIn > 1 && inputType != nil {
+		if inputType != nil {
+			// Limit request body size
+			var body *limitedBody
+			if maxBodySize > 0 && req.Body != nil {
+				body = newLimitedBody(req.Body, maxBodySize)
+				req.Body = body
+			}
+
 			// Coerce input type
+			done := phase(PhaseDecode)
 			input := reflect.New(inputType)
 			err = decoder(method, req, input.Interface())
+			done(err)
+			if body != nil && body.exceeded {
+				errorHandler(ctx, rw, req, http.StatusRequestEntityTooLarge, "Request body exceeds %d bytes", maxBodySize)
+				return
+			}
 			if err != nil {
 				errorHandler(ctx, rw, req, http.StatusBadRequest, "Data decoding error %s", err)
 				return
 			}
 
 			// Validate input fields
+			done = phase(PhaseValidate)
 			ok, err := validateHander(input.Interface())
+			if err == nil && !ok {
+				done(fmt.Errorf("Input data validation failed"))
+			} else {
+				done(err)
+			}
 			if err != nil {
 				errorHandler(ctx, rw, req, http.StatusBadRequest, "Input data validation error %s", err)
 				return
@@ -179,28 +289,50 @@ func generateWrapper(method string, fn interface{}, args ...interface{}) HTTPHan
 				return
 			}
 
-			// Append args to calling array
-			switch numIn {
-			case 2:
-				inputs = append(inputs, input.Elem())
-			case 3:
-				inputs = append(inputs, input.Elem(), reflect.ValueOf(req.Header))
-			default:
-				errorHandler(ctx, rw, req, http.StatusInternalServerError, "Invalid input parameter count")
-				return
+			// Append input to calling array
+			inputs = append(inputs, input.Elem())
+		}
+
+		// Start the handler phase prior to injection, so injected contexts carry the phase (see ContextObserver)
+		phaseCtx, handled := phaseContext(req.Context(), PhaseHandler)
+		req = req.WithContext(phaseCtx)
+
+		// Inject remaining parameters
+		numInjected := numIn - len(inputs)
+		if numInjected > 0 {
+			_, done := phaseContext(req.Context(), PhaseInject)
+			for i := len(inputs); i < numIn; i++ {
+				v, err := injectors.inject(vf.Type().In(i), req)
+				if err != nil {
+					done(err)
+					handled(err)
+					errorHandler(ctx, rw, req, http.StatusInternalServerError, "Parameter injection error %s", err)
+					return
+				}
+				inputs = append(inputs, v)
 			}
+			done(nil)
 		}
 
 		// Call reflected function
 		outputs := vf.Call(inputs)
 
 		// Parse function call errors
-		err, _ = reflect.ValueOf(outputs[numOut-1]).Interface().(error)
+		err, _ = outputs[numOut-1].Interface().(error)
+		handled(err)
 		if err != nil {
 			errorHandler(ctx, rw, req, http.StatusInternalServerError, "Internal Server Error %s", err)
 			return
 		}
 
+		// Finalize injected parameters
+		for i := numIn - numInjected; i < numIn; i++ {
+			if err := injectors.finalize(vf.Type().In(i), inputs[i], rw, req); err != nil {
+				errorHandler(ctx, rw, req, http.StatusInternalServerError, "Parameter finalization error %s", err)
+				return
+			}
+		}
+
 		// Fetch status code if returned
 		statusCode := http.StatusOK
 		if numOut > 2 {
@@ -219,7 +351,13 @@ func generateWrapper(method string, fn interface{}, args ...interface{}) HTTPHan
 		output := outputs[0].Interface()
 
 		// Validate output fields
+		done := phase(PhaseValidate)
 		ok, err := validateHander(output)
+		if err == nil && !ok {
+			done(fmt.Errorf("Output data validation failed"))
+		} else {
+			done(err)
+		}
 		if err != nil {
 			errorHandler(ctx, rw, req, http.StatusInternalServerError, "Output data validation error %s", err)
 			return
@@ -230,7 +368,9 @@ func generateWrapper(method string, fn interface{}, args ...interface{}) HTTPHan
 		}
 
 		// Encode outputs
+		done = phase(PhaseEncode)
 		err = encoder(rw, req, output, statusCode)
+		done(err)
 		if err != nil {
 			errorHandler(ctx, rw, req, http.StatusBadRequest, "Data encoding error %s", err)
 			return
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"testing"
 
 	//"github.com/stretchr/testify/assert"
@@ -93,3 +94,236 @@ func TestWrappers(t *testing.T) {
 		})
 	}
 }
+
+type Injected struct {
+	Path string
+}
+
+func TestInjectors(t *testing.T) {
+	RegisterInjector(reflect.TypeOf(Injected{}), func(req *http.Request) (interface{}, error) {
+		return Injected{Path: req.URL.Path}, nil
+	})
+	defer RemoveInjector(reflect.TypeOf(Injected{}))
+
+	t.Run("Injects parameters without input", func(t *testing.T) {
+		h, err := BuildEndpoint(http.MethodGet, func(ctx APICtx, i Injected) (Input, error) {
+			return Input{V: i.Path}, nil
+		})
+		require.Nil(t, err)
+
+		req, err := http.NewRequest(http.MethodGet, "/injected", nil)
+		require.Nil(t, err)
+		resp := httptest.NewRecorder()
+
+		h(APICtx{}, resp, req)
+		require.Equal(t, http.StatusOK, resp.Code)
+		require.Equal(t, `{"V":"/injected"}`, resp.Body.String())
+	})
+
+	t.Run("Injects parameters following input", func(t *testing.T) {
+		h, err := BuildEndpoint(http.MethodPost, func(ctx APICtx, test Input, hdr http.Header, i Injected) (Input, error) {
+			return Input{V: test.V + i.Path}, nil
+		})
+		require.Nil(t, err)
+
+		req, err := http.NewRequest(http.MethodPost, "/injected", bytes.NewReader([]byte(`{"V":"test"}`)))
+		require.Nil(t, err)
+		resp := httptest.NewRecorder()
+
+		h(APICtx{}, resp, req)
+		require.Equal(t, http.StatusOK, resp.Code)
+		require.Equal(t, `{"V":"test/injected"}`, resp.Body.String())
+	})
+
+	t.Run("Rejects unregistered parameter types", func(t *testing.T) {
+		_, err := BuildEndpoint(http.MethodPost, func(ctx APICtx, test Input, i APICtx) (Input, error) {
+			return test, nil
+		})
+		require.NotNil(t, err)
+	})
+
+	t.Run("Finalizes injected parameters", func(t *testing.T) {
+		RegisterFinalizer(reflect.TypeOf(Injected{}), func(rw http.ResponseWriter, req *http.Request, v interface{}) error {
+			rw.Header().Set("X-Finalized", v.(Injected).Path)
+			return nil
+		})
+
+		h, err := BuildEndpoint(http.MethodGet, func(ctx APICtx, i Injected) (Input, error) {
+			return Input{V: i.Path}, nil
+		})
+		require.Nil(t, err)
+
+		req, err := http.NewRequest(http.MethodGet, "/finalized", nil)
+		require.Nil(t, err)
+		resp := httptest.NewRecorder()
+
+		h(APICtx{}, resp, req)
+		require.Equal(t, http.StatusOK, resp.Code)
+		require.Equal(t, "/finalized", resp.Header().Get("X-Finalized"))
+	})
+}
+
+func TestInjectorRegistry(t *testing.T) {
+	injectors := NewInjectors()
+	require.Nil(t, injectors.Register(reflect.TypeOf(Injected{}), func(req *http.Request) (interface{}, error) {
+		return Injected{Path: "scoped" + req.URL.Path}, nil
+	}))
+
+	t.Run("Rejects duplicate registrations", func(t *testing.T) {
+		require.NotNil(t, injectors.Register(reflect.TypeOf(Injected{}), func(req *http.Request) (interface{}, error) {
+			return Injected{}, nil
+		}))
+	})
+
+	t.Run("Injects parameters from the provided registry", func(t *testing.T) {
+		fn := func(ctx APICtx, hdr http.Header, i Injected) (Input, error) {
+			return Input{V: i.Path}, nil
+		}
+
+		_, err := BuildEndpoint(http.MethodGet, fn)
+		require.NotNil(t, err)
+
+		h, err := BuildEndpoint(http.MethodGet, fn, injectors)
+		require.Nil(t, err)
+
+		req, err := http.NewRequest(http.MethodGet, "/injected", nil)
+		require.Nil(t, err)
+		resp := httptest.NewRecorder()
+
+		h(APICtx{}, resp, req)
+		require.Equal(t, http.StatusOK, resp.Code)
+		require.Equal(t, `{"V":"scoped/injected"}`, resp.Body.String())
+	})
+}
+
+func TestMaxBodySize(t *testing.T) {
+	fn := func(ctx APICtx, test Input) (Input, error) {
+		return test, nil
+	}
+
+	t.Run("Accepts bodies within limit", func(t *testing.T) {
+		h, err := BuildEndpoint(http.MethodPost, fn, MaxBodySize(32))
+		require.Nil(t, err)
+
+		req, err := http.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(`{"V":"test"}`)))
+		require.Nil(t, err)
+		resp := httptest.NewRecorder()
+
+		h(APICtx{}, resp, req)
+		require.Equal(t, http.StatusOK, resp.Code)
+	})
+
+	t.Run("Rejects bodies exceeding limit", func(t *testing.T) {
+		h, err := BuildEndpoint(http.MethodPost, fn, MaxBodySize(8))
+		require.Nil(t, err)
+
+		req, err := http.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(`{"V":"test"}`)))
+		require.Nil(t, err)
+		resp := httptest.NewRecorder()
+
+		h(APICtx{}, resp, req)
+		require.Equal(t, http.StatusRequestEntityTooLarge, resp.Code)
+	})
+
+	t.Run("Reports oversized bodies via the error handler", func(t *testing.T) {
+		code := 0
+		var errorHandler ErrorHandler = func(ctx interface{}, rw http.ResponseWriter, req *http.Request, c int, format string, args ...interface{}) {
+			code = c
+			rw.WriteHeader(c)
+		}
+
+		h, err := BuildEndpoint(http.MethodPost, fn, MaxBodySize(8), errorHandler)
+		require.Nil(t, err)
+
+		req, err := http.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(`{"V":"test"}`)))
+		require.Nil(t, err)
+
+		h(APICtx{}, httptest.NewRecorder(), req)
+		require.Equal(t, http.StatusRequestEntityTooLarge, code)
+	})
+}
+
+// phaseRecorder is an instrument recording ended phases
+type phaseRecorder struct {
+	ended []string
+	errs  []error
+}
+
+func (r *phaseRecorder) Start(e Endpoint, req *http.Request) Observer {
+	return r
+}
+
+func (r *phaseRecorder) Phase(name string) func(err error) {
+	return func(err error) {
+		r.ended = append(r.ended, name)
+		r.errs = append(r.errs, err)
+	}
+}
+
+func (r *phaseRecorder) Finish(status int) {}
+
+func TestRecover(t *testing.T) {
+	reported := make([]interface{}, 0)
+	reporter := PanicReporter(func(req *http.Request, recovered interface{}, stack []byte) {
+		reported = append(reported, recovered)
+		require.Contains(t, string(stack), "panic")
+	})
+
+	t.Run("Recovers typed endpoint panics", func(t *testing.T) {
+		h, err := BuildEndpoint(http.MethodGet, func(ctx APICtx) (Input, error) {
+			panic("endpoint panic")
+		}, reporter)
+		require.Nil(t, err)
+
+		req, err := http.NewRequest(http.MethodGet, "/", nil)
+		require.Nil(t, err)
+		resp := httptest.NewRecorder()
+
+		h(APICtx{}, resp, req)
+		require.Equal(t, http.StatusInternalServerError, resp.Code)
+		require.Equal(t, []interface{}{"endpoint panic"}, reported)
+	})
+
+	t.Run("Ends the active phase on panic", func(t *testing.T) {
+		inst := &phaseRecorder{}
+		h, err := BuildEndpoint(http.MethodGet, func(ctx APICtx) (Input, error) {
+			panic("endpoint panic")
+		}, inst)
+		require.Nil(t, err)
+
+		resp := httptest.NewRecorder()
+		h(APICtx{}, resp, httptest.NewRequest(http.MethodGet, "/", nil))
+		require.Equal(t, http.StatusInternalServerError, resp.Code)
+		require.Equal(t, []string{PhaseHandler}, inst.ended)
+		require.NotNil(t, inst.errs[0])
+	})
+
+	t.Run("Re-panics aborted handlers", func(t *testing.T) {
+		h, err := BuildEndpoint(http.MethodGet, func(ctx APICtx) (Input, error) {
+			panic(http.ErrAbortHandler)
+		}, reporter)
+		require.Nil(t, err)
+
+		require.PanicsWithValue(t, http.ErrAbortHandler, func() {
+			h(APICtx{}, httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		})
+
+		r := Recover(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			panic(http.ErrAbortHandler)
+		}), reporter)
+		require.PanicsWithValue(t, http.ErrAbortHandler, func() {
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		})
+	})
+
+	t.Run("Recovers handler panics", func(t *testing.T) {
+		h := Recover(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			panic("handler panic")
+		}), reporter)
+
+		resp := httptest.NewRecorder()
+		h.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/", nil))
+		require.Equal(t, http.StatusInternalServerError, resp.Code)
+		require.Equal(t, "handler panic", reported[len(reported)-1])
+	})
+}